@@ -29,6 +29,7 @@ KAFKA_BOOTSTRAP_SERVERS = os.getenv("KAFKA_BOOTSTRAP_SERVERS", "kafka:9092")
 REDIS_HOST = os.getenv("REDIS_HOST", "redis")
 REDIS_PORT = int(os.getenv("REDIS_PORT", "6379"))
 GATEWAY_URL = os.getenv("GATEWAY_URL", "http://gateway:8082")
+GATEWAY_ADMIN_TOKEN = os.getenv("GATEWAY_ADMIN_TOKEN")  # Operator token, if the gateway requires one
 
 # Decision Engine Thresholds
 THRESHOLD_PROMOTE = 0.99  # 99% consistency required to increase weight
@@ -74,8 +75,9 @@ def update_gateway_weight(service: str, weight: float) -> bool:
     """Send weight update request to Gateway"""
     try:
         url = f"{GATEWAY_URL}/admin/set-weight"
-        payload = {"service": service, "weight": weight}
-        response = requests.post(url, json=payload, timeout=5)
+        payload = {"service": service, "weight": weight, "reason": "arbiter decision engine"}
+        headers = {"Authorization": f"Bearer {GATEWAY_ADMIN_TOKEN}"} if GATEWAY_ADMIN_TOKEN else {}
+        response = requests.post(url, json=payload, headers=headers, timeout=5)
         
         if response.status_code == 200:
             print(f"✅ Gateway weight updated: {service} = {weight*100:.0f}%")
@@ -258,13 +260,20 @@ def consume_shadow_requests():
     for message in consumer:
         try:
             data = message.value
+            # Schema 2+ also reports requests only one backend served
+            if data.get('schema_version', 1) >= 2 and not data.get('compared'):
+                continue
+
             tx_id = data.get('transaction_id', 'unknown')
             service_type = data.get('service_type', 'php')
             legacy_status = data.get('legacy_status', 0)
             modern_status = data.get('modern_status', 0)
             
-            # Compare HTTP responses
-            is_match = legacy_status == modern_status and legacy_status != 0
+            # Use the gateway's body comparison when present, else compare HTTP statuses
+            if 'match' in data:
+                is_match = bool(data['match'])
+            else:
+                is_match = legacy_status == modern_status and legacy_status != 0
             
             r.incr("total_transactions")
             if is_match:
@@ -278,6 +287,8 @@ def consume_shadow_requests():
             
             status = "MATCH" if is_match else "MISMATCH"
             print(f"📥 Shadow {tx_id}: Legacy={legacy_status}, Modern={modern_status} → {status} | Score: {score:.2f}%")
+            if data.get('diff_paths'):
+                print(f"   Differing paths: {', '.join(data['diff_paths'])}")
             
         except Exception as e:
             print(f"Error processing shadow request: {e}")
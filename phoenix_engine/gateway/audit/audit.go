@@ -0,0 +1,220 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxEntries bounds how many entries are kept in memory for queries. The
+// file keeps the full history.
+const maxEntries = 10000
+
+// Entry is one admin change.
+type Entry struct {
+	ID        int64       `json:"id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Actor     string      `json:"actor"`
+	SourceIP  string      `json:"source_ip"`
+	Action    string      `json:"action"`
+	Service   string      `json:"service,omitempty"`
+	Route     string      `json:"route,omitempty"`
+	OldValue  interface{} `json:"old_value"`
+	NewValue  interface{} `json:"new_value"`
+	Reason    string      `json:"reason,omitempty"`
+}
+
+// Filter selects entries in Query. Zero fields match everything.
+type Filter struct {
+	Actor   string
+	Action  string
+	Service string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+// Log is an append-only audit trail. Entries are appended to an NDJSON file
+// when one is open, kept in memory for queries, and handed to Publish.
+type Log struct {
+	mu      sync.Mutex
+	file    *os.File
+	path    string
+	entries []Entry
+	nextID  int64
+	corrupt int // Unreadable lines skipped when the file was loaded
+
+	// Publish, if set, receives every entry as JSON (e.g. to Kafka).
+	Publish func(data []byte)
+}
+
+var GlobalLog = &Log{nextID: 1}
+
+// Open appends to the NDJSON file at path, loading the most recent entries
+// already in it so they stay queryable after a restart. Unreadable lines,
+// e.g. one torn by a crash mid-write, are skipped and counted rather than
+// failing the start; the file keeps them for inspection.
+func (l *Log) Open(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	torn, err := l.loadLocked(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if torn {
+		// Start a new line so the next entry is not glued onto the torn one
+		if _, err := file.Write([]byte{'\n'}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	l.file = file
+	l.path = path
+	return nil
+}
+
+// loadLocked reads the entries in path. It reports whether the file ends
+// in a partial line.
+func (l *Log) loadLocked(path string) (torn bool, err error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			torn = line[len(line)-1] != '\n'
+			var entry Entry
+			if jsonErr := json.Unmarshal(line, &entry); jsonErr != nil {
+				slog.Warn("skipping corrupt audit line", "path", path, "line", lineNo, "error", jsonErr)
+				l.corrupt++
+			} else {
+				l.appendLocked(entry)
+				if entry.ID >= l.nextID {
+					l.nextID = entry.ID + 1
+				}
+			}
+		}
+		if err == io.EOF {
+			return torn, nil
+		}
+		if err != nil {
+			return torn, err
+		}
+	}
+}
+
+// Corrupt returns how many unreadable lines Open skipped.
+func (l *Log) Corrupt() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.corrupt
+}
+
+// Record stamps entry with an ID and timestamp and appends it. A failure to
+// write the file is logged; the change it describes has already happened.
+func (l *Log) Record(entry Entry) Entry {
+	l.mu.Lock()
+	entry.ID = l.nextID
+	l.nextID++
+	entry.Timestamp = time.Now().UTC()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		l.mu.Unlock()
+		slog.Error("failed to encode audit entry", "action", entry.Action, "service", entry.Service, "error", err)
+		return entry
+	}
+
+	if l.file != nil {
+		if _, err := l.file.Write(append(data, '\n')); err != nil {
+			slog.Error("failed to write audit entry", "path", l.path, "id", entry.ID, "error", err)
+		}
+	}
+	l.appendLocked(entry)
+	publish := l.Publish
+	l.mu.Unlock()
+
+	slog.Info("audit", "id", entry.ID, "action", entry.Action, "service", entry.Service, "route", entry.Route,
+		"old", compact(entry.OldValue), "new", compact(entry.NewValue),
+		"actor", entry.Actor, "source_ip", entry.SourceIP, "reason", entry.Reason)
+
+	if publish != nil {
+		publish(data)
+	}
+	return entry
+}
+
+func (l *Log) appendLocked(entry Entry) {
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > maxEntries {
+		l.entries = append([]Entry(nil), l.entries[len(l.entries)-maxEntries:]...)
+	}
+}
+
+// Query returns matching entries, newest first.
+func (l *Log) Query(f Filter) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := []Entry{}
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		e := l.entries[i]
+		if f.Actor != "" && e.Actor != f.Actor {
+			continue
+		}
+		if f.Action != "" && e.Action != f.Action {
+			continue
+		}
+		if f.Service != "" && e.Service != f.Service {
+			continue
+		}
+		if !f.Since.IsZero() && e.Timestamp.Before(f.Since) {
+			continue
+		}
+		if !f.Until.IsZero() && e.Timestamp.After(f.Until) {
+			continue
+		}
+		result = append(result, e)
+		if f.Limit > 0 && len(result) >= f.Limit {
+			break
+		}
+	}
+	return result
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func compact(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
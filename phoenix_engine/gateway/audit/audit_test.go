@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenSkipsTornLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	if err := os.WriteFile(path, []byte(`{"id":1,"action":"set-weight"}`+"\n"+`{"id":2,"act`), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Log{nextID: 1}
+	if err := l.Open(path); err != nil {
+		t.Fatalf("Open with a torn last line: %v", err)
+	}
+	if n := l.Corrupt(); n != 1 {
+		t.Fatalf("%d corrupt lines; want 1", n)
+	}
+	if entry := l.Record(Entry{Action: "lock"}); entry.ID != 2 {
+		t.Fatalf("new entry got ID %d; want 2", entry.ID)
+	}
+	l.Close()
+
+	// The new entry starts on its own line after the torn one
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var last Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		json.Unmarshal(scanner.Bytes(), &last)
+	}
+	if last.Action != "lock" {
+		t.Fatalf("last line holds %+v; want the lock entry", last)
+	}
+}
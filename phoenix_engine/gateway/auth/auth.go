@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Role is what an authenticated caller may do on the admin API.
+type Role int
+
+const (
+	// Viewer may read status, weights, locks and the audit log.
+	Viewer Role = iota + 1
+	// Operator may also change weights, locks and migrations.
+	Operator
+)
+
+func ParseRole(s string) (Role, error) {
+	switch s {
+	case "viewer":
+		return Viewer, nil
+	case "operator":
+		return Operator, nil
+	}
+	return 0, fmt.Errorf("unknown role %q (use viewer or operator)", s)
+}
+
+func (r Role) String() string {
+	switch r {
+	case Viewer:
+		return "viewer"
+	case Operator:
+		return "operator"
+	}
+	return "none"
+}
+
+// Principal is an authenticated admin caller.
+type Principal struct {
+	Name   string
+	Role   Role
+	Method string // "token", "hmac" or "mtls"
+}
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials of its kind, so the next one in a Chain gets a turn.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator identifies the caller of an admin request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries each authenticator in order. The first one that finds its kind
+// of credentials decides; bad credentials are not retried with the others.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+type principalKey struct{}
+
+// WithPrincipal stores the caller in the request context.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller stored by WithPrincipal, or nil when admin
+// authentication is disabled.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,47 @@
+package auth
+
+import "gateway/config"
+
+// FromConfig builds the admin authenticator described by cfg. It returns nil
+// when nothing is configured, which leaves the admin API open.
+func FromConfig(cfg config.AdminAuthFile) Authenticator {
+	var chain Chain
+
+	if len(cfg.ClientCerts) > 0 {
+		certs := NewMTLSAuthenticator()
+		for _, c := range cfg.ClientCerts {
+			certs.Add(c.CommonName, mustRole(c.Role))
+		}
+		chain = append(chain, certs)
+	}
+
+	if len(cfg.HMACKeys) > 0 {
+		keys := NewHMACAuthenticator()
+		for _, k := range cfg.HMACKeys {
+			keys.Add(k.KeyID, k.Secret, k.Name, mustRole(k.Role))
+		}
+		chain = append(chain, keys)
+	}
+
+	if len(cfg.Tokens) > 0 {
+		tokens := NewTokenAuthenticator()
+		for _, t := range cfg.Tokens {
+			tokens.Add(t.Token, t.Name, mustRole(t.Role))
+		}
+		chain = append(chain, tokens)
+	}
+
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain
+}
+
+// mustRole parses a role that config.FileConfig.Validate already checked.
+func mustRole(s string) Role {
+	role, err := ParseRole(s)
+	if err != nil {
+		panic(err)
+	}
+	return role
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// MTLSAuthenticator maps verified client certificates to principals by
+// subject common name. The TLS listener must verify the chain against the
+// client CA; this only looks at certificates that passed.
+type MTLSAuthenticator struct {
+	names map[string]Role
+}
+
+func NewMTLSAuthenticator() *MTLSAuthenticator {
+	return &MTLSAuthenticator{names: map[string]Role{}}
+}
+
+func (m *MTLSAuthenticator) Add(commonName string, role Role) {
+	m.names[commonName] = role
+}
+
+func (m *MTLSAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	role, ok := m.names[cn]
+	if !ok {
+		return nil, fmt.Errorf("client certificate %q is not authorized", cn)
+	}
+	return &Principal{Name: cn, Role: role, Method: "mtls"}, nil
+}
@@ -0,0 +1,292 @@
+// Package breaker keeps a circuit breaker per migration that watches the
+// modern backend. An open breaker drops the effective weight and shadow
+// sample to 0, so every request is served by legacy alone, without touching
+// the values stored in config, until half-open probes succeed or an operator
+// resets it.
+package breaker
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"gateway/audit"
+	"gateway/config"
+)
+
+// Breaker states.
+const (
+	Closed   = "closed"
+	Open     = "open"
+	HalfOpen = "half_open"
+)
+
+// Status is a breaker's state as reported by the admin API.
+type Status struct {
+	Service      string     `json:"service"`
+	State        string     `json:"state"`
+	Requests     int        `json:"requests"` // Modern calls in the current window
+	ErrorRate    float64    `json:"error_rate"`
+	SlowCallRate float64    `json:"slow_call_rate"`
+	OpenedAt     *time.Time `json:"opened_at,omitempty"`
+	Reason       string     `json:"reason,omitempty"` // Why the breaker last opened
+}
+
+// bucket counts the modern calls made during one second.
+type bucket struct {
+	second int64
+	total  int
+	errors int
+	slow   int
+}
+
+type breaker struct {
+	state     string
+	buckets   []bucket
+	openedAt  time.Time
+	reason    string
+	successes int         // Successful probes while half-open
+	probes    []time.Time // Deadlines of the probes in flight while half-open
+}
+
+// Registry holds the breakers for all migrations.
+type Registry struct {
+	mu       sync.Mutex
+	breakers map[string]*breaker
+
+	// OnOpen, if set, is called after a breaker opens.
+	OnOpen func(service, reason string)
+}
+
+var Global = &Registry{breakers: map[string]*breaker{}}
+
+// Admit applies the breaker to a resolved target. While the breaker is open
+// the target gets weight 0, no shadow sample and BreakerOpen, so legacy
+// serves it alone. Once OpenDuration has passed the breaker turns half-open
+// and admits up to HalfOpenProbes requests at a time as probes: legacy still
+// answers them and modern gets a shadow copy whose outcome Record counts.
+// Every other request is routed as if the breaker were open.
+func (reg *Registry) Admit(target config.RouteTarget) config.RouteTarget {
+	if target.CircuitBreaker == nil {
+		return target
+	}
+	settings := target.CircuitBreaker.WithDefaults()
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	b, ok := reg.breakers[target.Service]
+	if !ok || b.state == Closed {
+		return target
+	}
+	if b.state == Open && time.Since(b.openedAt) >= time.Duration(settings.OpenDuration) {
+		b.state = HalfOpen
+		b.successes = 0
+		b.probes = nil
+		slog.Info("circuit breaker half-open, probing modern", "service", target.Service)
+		record(target.Service, "breaker-half-open", Open, HalfOpen, "")
+	}
+	target.Weight = 0
+	target.ShadowSample = 0
+	target.BreakerOpen = true
+	if b.state == HalfOpen && b.admitProbeLocked(settings, target.ShadowTimeoutFor("modern")) {
+		target.ShadowSample = 1
+		target.Probe = true
+	}
+	return target
+}
+
+// admitProbeLocked reserves a probe slot until timeout has passed, which is
+// when the shadow call to modern gives up. Slots of probes that never
+// reached modern, e.g. requests forced to legacy, expire the same way.
+func (b *breaker) admitProbeLocked(settings config.CircuitBreaker, timeout time.Duration) bool {
+	now := time.Now()
+	live := b.probes[:0]
+	for _, deadline := range b.probes {
+		if deadline.After(now) {
+			live = append(live, deadline)
+		}
+	}
+	b.probes = live
+	if len(b.probes) >= settings.HalfOpenProbes {
+		return false
+	}
+	if timeout <= 0 {
+		timeout = time.Duration(settings.OpenDuration)
+	}
+	b.probes = append(b.probes, now.Add(timeout))
+	return true
+}
+
+// Record counts the outcome of one modern call. err is the transport error,
+// if any; otherwise a 5xx status counts as a failure. While half-open only
+// the calls of targets Admit marked as probes count.
+func (reg *Registry) Record(target config.RouteTarget, status int, err error, duration time.Duration) {
+	if target.CircuitBreaker == nil {
+		return
+	}
+	settings := target.CircuitBreaker.WithDefaults()
+	failed := err != nil || status >= 500
+	slow := settings.SlowCallRate > 0 && duration >= time.Duration(settings.SlowCallDuration)
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	b := reg.breakerLocked(target.Service, settings)
+	now := time.Now()
+
+	switch b.state {
+	case Open:
+		// Calls still in flight when the breaker opened
+		return
+	case HalfOpen:
+		if !target.Probe {
+			// e.g. a failover to modern; probes alone decide
+			return
+		}
+		if len(b.probes) > 0 {
+			b.probes = b.probes[1:]
+		}
+		if failed || slow {
+			reg.openLocked(target.Service, b, HalfOpen, "half-open probe failed", now)
+			return
+		}
+		b.successes++
+		if b.successes >= settings.HalfOpenProbes {
+			b.state = Closed
+			b.reason = ""
+			b.buckets = make([]bucket, len(b.buckets))
+			slog.Info("circuit breaker closed", "service", target.Service, "probes", b.successes)
+			record(target.Service, "breaker-close", HalfOpen, Closed, fmt.Sprintf("%d successful probes", b.successes))
+		}
+		return
+	}
+
+	sec := now.Unix()
+	bk := &b.buckets[sec%int64(len(b.buckets))]
+	if bk.second != sec {
+		*bk = bucket{second: sec}
+	}
+	bk.total++
+	if failed {
+		bk.errors++
+	}
+	if slow {
+		bk.slow++
+	}
+
+	total, errors, slowCalls := b.countLocked(sec)
+	if total < settings.MinRequests {
+		return
+	}
+	errorRate := float64(errors) / float64(total)
+	slowRate := float64(slowCalls) / float64(total)
+	switch {
+	case settings.ErrorRate > 0 && errorRate >= settings.ErrorRate:
+		reg.openLocked(target.Service, b, Closed, fmt.Sprintf("error rate %.0f%% over %d calls in %s (threshold %.0f%%)",
+			errorRate*100, total, settings.Window, settings.ErrorRate*100), now)
+	case settings.SlowCallRate > 0 && slowRate >= settings.SlowCallRate:
+		reg.openLocked(target.Service, b, Closed, fmt.Sprintf("%.0f%% of %d calls slower than %s in %s (threshold %.0f%%)",
+			slowRate*100, total, settings.SlowCallDuration, settings.Window, settings.SlowCallRate*100), now)
+	}
+}
+
+// Reset closes the breaker for service and clears its window. It reports
+// the state the breaker was in.
+func (reg *Registry) Reset(service string) string {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	b, ok := reg.breakers[service]
+	if !ok {
+		return Closed
+	}
+	old := b.state
+	delete(reg.breakers, service)
+	return old
+}
+
+// Status reports the breaker of every migration that has one configured.
+func (reg *Registry) Status(migrations []config.Migration) []Status {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	now := time.Now().Unix()
+	list := []Status{}
+	for _, m := range migrations {
+		if m.CircuitBreaker == nil {
+			continue
+		}
+		status := Status{Service: m.Name, State: Closed}
+		if b, ok := reg.breakers[m.Name]; ok {
+			total, errors, slow := b.countLocked(now)
+			status.State = b.state
+			status.Requests = total
+			if total > 0 {
+				status.ErrorRate = float64(errors) / float64(total)
+				status.SlowCallRate = float64(slow) / float64(total)
+			}
+			if !b.openedAt.IsZero() {
+				openedAt := b.openedAt
+				status.OpenedAt = &openedAt
+			}
+			status.Reason = b.reason
+		}
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Service < list[j].Service })
+	return list
+}
+
+// breakerLocked returns the breaker for service, resizing its window when
+// the configured length changed.
+func (reg *Registry) breakerLocked(service string, settings config.CircuitBreaker) *breaker {
+	size := int(time.Duration(settings.Window) / time.Second)
+	b, ok := reg.breakers[service]
+	if !ok {
+		b = &breaker{state: Closed}
+		reg.breakers[service] = b
+	}
+	if len(b.buckets) != size {
+		b.buckets = make([]bucket, size)
+	}
+	return b
+}
+
+func (reg *Registry) openLocked(service string, b *breaker, from, reason string, now time.Time) {
+	b.state = Open
+	b.openedAt = now
+	b.reason = reason
+	b.probes = nil
+	slog.Warn("circuit breaker opened", "service", service, "reason", reason)
+	record(service, "breaker-open", from, Open, reason)
+	if reg.OnOpen != nil {
+		go reg.OnOpen(service, reason)
+	}
+}
+
+func (b *breaker) countLocked(now int64) (total, errors, slow int) {
+	for _, bk := range b.buckets {
+		if bk.second > now-int64(len(b.buckets)) {
+			total += bk.total
+			errors += bk.errors
+			slow += bk.slow
+		}
+	}
+	return total, errors, slow
+}
+
+// record writes a breaker transition to the audit log, which also publishes
+// it to the audit topic.
+func record(service, action, from, to, reason string) {
+	audit.GlobalLog.Record(audit.Entry{
+		Actor:    "circuit-breaker",
+		Action:   action,
+		Service:  service,
+		OldValue: from,
+		NewValue: to,
+		Reason:   reason,
+	})
+}
@@ -0,0 +1,83 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+func testTarget(service string) config.RouteTarget {
+	return config.RouteTarget{
+		Service:       service,
+		Weight:        0.5,
+		ShadowSample:  1,
+		LegacyTimeout: time.Second,
+		ModernTimeout: time.Second,
+		CircuitBreaker: &config.CircuitBreaker{
+			ErrorRate:      0.5,
+			MinRequests:    2,
+			OpenDuration:   config.Duration(time.Hour),
+			HalfOpenProbes: 2,
+		},
+	}
+}
+
+func trip(reg *Registry, target config.RouteTarget) {
+	for i := 0; i < target.CircuitBreaker.MinRequests; i++ {
+		reg.Record(target, 0, errors.New("connection refused"), time.Millisecond)
+	}
+}
+
+func TestOpenBreakerRoutesToLegacyWithoutLocking(t *testing.T) {
+	reg := &Registry{breakers: map[string]*breaker{}}
+	target := testTarget("open")
+	trip(reg, target)
+
+	got := reg.Admit(target)
+	if got.Weight != 0 || got.ShadowSample != 0 {
+		t.Fatalf("open breaker admitted weight %.2f, shadow sample %.2f; want 0, 0", got.Weight, got.ShadowSample)
+	}
+	if got.Locked {
+		t.Fatal("open breaker locked the target")
+	}
+}
+
+func TestHalfOpenCapsProbesInFlight(t *testing.T) {
+	reg := &Registry{breakers: map[string]*breaker{}}
+	target := testTarget("half-open")
+	trip(reg, target)
+	reg.breakers[target.Service].openedAt = time.Now().Add(-2 * time.Hour)
+
+	var probe config.RouteTarget
+	probes := 0
+	for i := 0; i < 5; i++ {
+		got := reg.Admit(target)
+		if got.Weight != 0 {
+			t.Fatalf("half-open breaker admitted weight %.2f; want 0", got.Weight)
+		}
+		if got.ShadowSample == 1 {
+			probe = got
+			probes++
+		}
+	}
+	if probes != target.CircuitBreaker.HalfOpenProbes {
+		t.Fatalf("admitted %d probes; want %d", probes, target.CircuitBreaker.HalfOpenProbes)
+	}
+
+	// A modern call that was not a probe neither frees a slot nor counts
+	reg.Record(target, 500, nil, time.Millisecond)
+	if got := reg.Admit(target); got.ShadowSample == 1 {
+		t.Fatal("probe admitted after a call that was not a probe")
+	}
+	if state := reg.breakers[target.Service].state; state != HalfOpen {
+		t.Fatalf("state %s after a call that was not a probe; want %s", state, HalfOpen)
+	}
+
+	// A finished probe frees its slot
+	reg.Record(probe, 200, nil, time.Millisecond)
+	if got := reg.Admit(target); got.ShadowSample != 1 {
+		t.Fatal("no probe admitted after one finished")
+	}
+}
@@ -0,0 +1,306 @@
+// Package compare diffs legacy and modern JSON responses for shadow events.
+package compare
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gateway/config"
+)
+
+// maxDiffs caps how many differing paths a result lists, to keep events
+// small when a response is completely different.
+const maxDiffs = 20
+
+// Result is the verdict for one pair of bodies.
+type Result struct {
+	Match     bool     `json:"match"`
+	DiffPaths []string `json:"diff_paths,omitempty"` // "$" when the bodies differ as a whole
+	Truncated bool     `json:"truncated,omitempty"`  // More paths differed than DiffPaths lists
+}
+
+// JSON compares two response bodies under rules. Bodies that are not both
+// valid JSON are compared byte for byte.
+func JSON(legacy, modern []byte, rules config.CompareRules) Result {
+	legacyValue, legacyErr := decode(legacy)
+	modernValue, modernErr := decode(modern)
+	if legacyErr != nil || modernErr != nil {
+		if bytes.Equal(bytes.TrimSpace(legacy), bytes.TrimSpace(modern)) {
+			return Result{Match: true}
+		}
+		return Result{DiffPaths: []string{"$"}}
+	}
+
+	c := &comparer{
+		ignore:    compilePatterns(rules.IgnorePaths),
+		unordered: compilePatterns(rules.UnorderedArrays),
+	}
+	for p, tolerance := range rules.NumericTolerance {
+		c.tolerances = append(c.tolerances, tolerancePattern{pattern: compilePattern(p), tolerance: tolerance})
+	}
+
+	c.diff(nil, legacyValue, modernValue)
+	return Result{
+		Match:     c.count == 0,
+		DiffPaths: c.paths,
+		Truncated: c.count > len(c.paths),
+	}
+}
+
+func decode(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+type tolerancePattern struct {
+	pattern   []string
+	tolerance float64
+}
+
+type comparer struct {
+	ignore     [][]string
+	unordered  [][]string
+	tolerances []tolerancePattern
+
+	paths []string
+	count int
+}
+
+func (c *comparer) report(path []string) {
+	c.count++
+	if len(c.paths) < maxDiffs {
+		c.paths = append(c.paths, formatPath(path))
+	}
+}
+
+// diff walks both values and reports every path where they differ.
+func (c *comparer) diff(path []string, legacy, modern interface{}) {
+	if matchAny(c.ignore, path) {
+		return
+	}
+
+	switch l := legacy.(type) {
+	case map[string]interface{}:
+		m, ok := modern.(map[string]interface{})
+		if !ok {
+			c.report(path)
+			return
+		}
+		for _, key := range sortedKeys(l) {
+			lv := l[key]
+			child := appendPath(path, key)
+			mv, ok := m[key]
+			if !ok {
+				if !matchAny(c.ignore, child) {
+					c.report(child)
+				}
+				continue
+			}
+			c.diff(child, lv, mv)
+		}
+		for _, key := range sortedKeys(m) {
+			if _, ok := l[key]; !ok {
+				child := appendPath(path, key)
+				if !matchAny(c.ignore, child) {
+					c.report(child)
+				}
+			}
+		}
+
+	case []interface{}:
+		m, ok := modern.([]interface{})
+		if !ok {
+			c.report(path)
+			return
+		}
+		if matchAny(c.unordered, path) {
+			if !c.sameElements(path, l, m) {
+				c.report(path)
+			}
+			return
+		}
+		if len(l) != len(m) {
+			c.report(path)
+			return
+		}
+		for i := range l {
+			c.diff(appendPath(path, "["+strconv.Itoa(i)+"]"), l[i], m[i])
+		}
+
+	case json.Number:
+		m, ok := modern.(json.Number)
+		if !ok || !c.numbersMatch(path, l, m) {
+			c.report(path)
+		}
+
+	default:
+		// Strings, booleans and null
+		if legacy != modern {
+			c.report(path)
+		}
+	}
+}
+
+// sameElements reports whether both arrays hold the same elements in any
+// order, pairing each legacy element with an unused equal modern element.
+func (c *comparer) sameElements(path []string, legacy, modern []interface{}) bool {
+	if len(legacy) != len(modern) {
+		return false
+	}
+	used := make([]bool, len(modern))
+	for _, lv := range legacy {
+		found := false
+		for j, mv := range modern {
+			if used[j] {
+				continue
+			}
+			probe := &comparer{ignore: c.ignore, unordered: c.unordered, tolerances: c.tolerances}
+			probe.diff(appendPath(path, "[]"), lv, mv)
+			if probe.count == 0 {
+				used[j] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *comparer) numbersMatch(path []string, legacy, modern json.Number) bool {
+	if legacy == modern {
+		return true
+	}
+	l, lErr := legacy.Float64()
+	m, mErr := modern.Float64()
+	if lErr != nil || mErr != nil {
+		return false
+	}
+
+	tolerance := 0.0
+	for _, tp := range c.tolerances {
+		if matchPattern(tp.pattern, path) && tp.tolerance > tolerance {
+			tolerance = tp.tolerance
+		}
+	}
+	// A small epsilon absorbs float rounding of the tolerance itself
+	return math.Abs(l-m) <= tolerance+1e-12
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendPath(path []string, segment string) []string {
+	child := make([]string, len(path)+1)
+	copy(child, path)
+	child[len(path)] = segment
+	return child
+}
+
+// formatPath renders segments as "data.items[2].amount", or "$" for the root.
+func formatPath(path []string) string {
+	if len(path) == 0 {
+		return "$"
+	}
+	var b strings.Builder
+	if strings.HasPrefix(path[0], "[") {
+		b.WriteByte('$')
+	}
+	for i, segment := range path {
+		if i > 0 && !strings.HasPrefix(segment, "[") {
+			b.WriteByte('.')
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
+
+func compilePatterns(patterns []string) [][]string {
+	compiled := make([][]string, 0, len(patterns))
+	for _, p := range patterns {
+		compiled = append(compiled, compilePattern(p))
+	}
+	return compiled
+}
+
+// compilePattern splits "data.items[].amount" into "data", "items", "[]",
+// "amount" so it lines up with the segments diff builds.
+func compilePattern(p string) []string {
+	var segments []string
+	for _, part := range strings.Split(p, ".") {
+		for {
+			open := strings.Index(part, "[")
+			if open < 0 {
+				break
+			}
+			if open > 0 {
+				segments = append(segments, part[:open])
+			}
+			end := strings.Index(part[open:], "]")
+			if end < 0 {
+				break
+			}
+			segments = append(segments, part[open:open+end+1])
+			part = part[open+end+1:]
+		}
+		if part != "" {
+			segments = append(segments, part)
+		}
+	}
+	return segments
+}
+
+func matchAny(patterns [][]string, path []string) bool {
+	for _, p := range patterns {
+		if matchPattern(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPattern(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 || !matchSegment(pattern[0], path[0]) {
+		return false
+	}
+	return matchPattern(pattern[1:], path[1:])
+}
+
+func matchSegment(pattern, segment string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case pattern == "[]" || pattern == "[*]":
+		return strings.HasPrefix(segment, "[")
+	default:
+		return pattern == segment
+	}
+}
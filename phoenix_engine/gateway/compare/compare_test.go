@@ -0,0 +1,154 @@
+package compare
+
+import (
+	"reflect"
+	"testing"
+
+	"gateway/config"
+)
+
+func TestJSON(t *testing.T) {
+	rules := config.CompareRules{
+		IgnorePaths:      []string{"**.timestamp", "meta.*"},
+		NumericTolerance: map[string]float64{"**.amount": 0.01, "data.items[].price": 0.5},
+		UnorderedArrays:  []string{"data.items", "tags"},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		legacy    string
+		modern    string
+		wantMatch bool
+		wantPaths []string
+	}{
+		{
+			name:      "identical",
+			legacy:    `{"status":"ok","balance":10}`,
+			modern:    `{"balance":10,"status":"ok"}`,
+			wantMatch: true,
+		},
+		{
+			name:      "ignored at any depth",
+			legacy:    `{"timestamp":1,"data":{"timestamp":"a"}}`,
+			modern:    `{"timestamp":2,"data":{"timestamp":"b"}}`,
+			wantMatch: true,
+		},
+		{
+			name:      "ignored key missing on one side",
+			legacy:    `{"meta":{"host":"legacy-1"}}`,
+			modern:    `{"meta":{}}`,
+			wantMatch: true,
+		},
+		{
+			name:      "not ignored",
+			legacy:    `{"status":"ok","meta":{"host":"a"}}`,
+			modern:    `{"status":"failed","meta":{"host":"b"}}`,
+			wantPaths: []string{"status"},
+		},
+		{
+			name:      "within tolerance",
+			legacy:    `{"transfer":{"amount":25.50}}`,
+			modern:    `{"transfer":{"amount":25.505}}`,
+			wantMatch: true,
+		},
+		{
+			name:      "tolerance boundary",
+			legacy:    `{"amount":1.00}`,
+			modern:    `{"amount":1.01}`,
+			wantMatch: true,
+		},
+		{
+			name:      "beyond tolerance",
+			legacy:    `{"transfer":{"amount":25.50}}`,
+			modern:    `{"transfer":{"amount":25.52}}`,
+			wantPaths: []string{"transfer.amount"},
+		},
+		{
+			name:      "no tolerance on other numbers",
+			legacy:    `{"balance":100}`,
+			modern:    `{"balance":100.001}`,
+			wantPaths: []string{"balance"},
+		},
+		{
+			name:      "same number, different notation",
+			legacy:    `{"balance":100}`,
+			modern:    `{"balance":1e2}`,
+			wantMatch: true,
+		},
+		{
+			name:      "unordered array in another order",
+			legacy:    `{"tags":["a","b","c"]}`,
+			modern:    `{"tags":["c","a","b"]}`,
+			wantMatch: true,
+		},
+		{
+			name:      "unordered array with tolerance inside elements",
+			legacy:    `{"data":{"items":[{"id":1,"price":10},{"id":2,"price":20}]}}`,
+			modern:    `{"data":{"items":[{"id":2,"price":20.4},{"id":1,"price":10}]}}`,
+			wantMatch: true,
+		},
+		{
+			name:      "unordered array with a duplicate",
+			legacy:    `{"tags":["a","a","b"]}`,
+			modern:    `{"tags":["a","b","b"]}`,
+			wantPaths: []string{"tags"},
+		},
+		{
+			name:      "ordered array in another order",
+			legacy:    `{"list":[1,2]}`,
+			modern:    `{"list":[2,1]}`,
+			wantPaths: []string{"list[0]", "list[1]"},
+		},
+		{
+			name:      "type mismatch",
+			legacy:    `{"id":"1"}`,
+			modern:    `{"id":1}`,
+			wantPaths: []string{"id"},
+		},
+		{
+			name:      "missing and extra keys",
+			legacy:    `{"a":1,"b":2}`,
+			modern:    `{"b":2,"c":3}`,
+			wantPaths: []string{"a", "c"},
+		},
+		{
+			name:      "not JSON, equal bytes",
+			legacy:    "OK\n",
+			modern:    "OK",
+			wantMatch: true,
+		},
+		{
+			name:      "not JSON, different bytes",
+			legacy:    "OK",
+			modern:    `{"ok":true}`,
+			wantPaths: []string{"$"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := JSON([]byte(tc.legacy), []byte(tc.modern), rules)
+			if got.Match != tc.wantMatch || !reflect.DeepEqual(got.DiffPaths, tc.wantPaths) {
+				t.Fatalf("JSON() = match %v, paths %v; want match %v, paths %v",
+					got.Match, got.DiffPaths, tc.wantMatch, tc.wantPaths)
+			}
+		})
+	}
+}
+
+func TestJSONTruncatesDiffPaths(t *testing.T) {
+	legacy, modern := []byte("["), []byte("[")
+	for i := 0; i < maxDiffs+5; i++ {
+		if i > 0 {
+			legacy, modern = append(legacy, ','), append(modern, ',')
+		}
+		legacy, modern = append(legacy, '0'), append(modern, '1')
+	}
+	legacy, modern = append(legacy, ']'), append(modern, ']')
+
+	got := JSON(legacy, modern, config.CompareRules{})
+	if len(got.DiffPaths) != maxDiffs || !got.Truncated {
+		t.Fatalf("%d paths, truncated %v; want %d, true", len(got.DiffPaths), got.Truncated, maxDiffs)
+	}
+	if got.DiffPaths[0] != "$[0]" {
+		t.Fatalf("first path %q; want $[0]", got.DiffPaths[0])
+	}
+}
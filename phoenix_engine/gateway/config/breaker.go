@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// CircuitBreaker trips a migration back to legacy when modern misbehaves.
+// Modern calls are counted over Window; once at least MinRequests were seen
+// and either rate is reached, the breaker opens. A zero rate disables that
+// check. The breaker state itself lives in the breaker package.
+type CircuitBreaker struct {
+	ErrorRate        float64  `json:"error_rate" yaml:"error_rate"`                 // Share of 5xx or failed calls
+	SlowCallRate     float64  `json:"slow_call_rate" yaml:"slow_call_rate"`         // Share of calls slower than SlowCallDuration
+	SlowCallDuration Duration `json:"slow_call_duration" yaml:"slow_call_duration"` // Required with SlowCallRate
+	Window           Duration `json:"window" yaml:"window"`                         // Default 60s
+	MinRequests      int      `json:"min_requests" yaml:"min_requests"`             // Default 20
+	OpenDuration     Duration `json:"open_duration" yaml:"open_duration"`           // Time before probing again, default 30s
+	HalfOpenProbes   int      `json:"half_open_probes" yaml:"half_open_probes"`     // Successes needed to close and probes in flight at once, default 5
+}
+
+// WithDefaults returns cb with zero settings replaced by their defaults.
+func (cb CircuitBreaker) WithDefaults() CircuitBreaker {
+	if cb.Window == 0 {
+		cb.Window = Duration(60 * time.Second)
+	}
+	if cb.MinRequests == 0 {
+		cb.MinRequests = 20
+	}
+	if cb.OpenDuration == 0 {
+		cb.OpenDuration = Duration(30 * time.Second)
+	}
+	if cb.HalfOpenProbes == 0 {
+		cb.HalfOpenProbes = 5
+	}
+	return cb
+}
+
+func (cb *CircuitBreaker) Validate() error {
+	if cb.ErrorRate == 0 && cb.SlowCallRate == 0 {
+		return fmt.Errorf("circuit_breaker needs error_rate or slow_call_rate")
+	}
+	if cb.ErrorRate < 0 || cb.ErrorRate > 1 || cb.SlowCallRate < 0 || cb.SlowCallRate > 1 {
+		return fmt.Errorf("circuit_breaker rates must be between 0 and 1")
+	}
+	if cb.SlowCallRate > 0 && cb.SlowCallDuration <= 0 {
+		return fmt.Errorf("circuit_breaker slow_call_rate needs a positive slow_call_duration")
+	}
+	if cb.Window < 0 || cb.OpenDuration < 0 || cb.MinRequests < 0 || cb.HalfOpenProbes < 0 {
+		return fmt.Errorf("circuit_breaker settings must not be negative")
+	}
+	if cb.Window > 0 && cb.Window < Duration(time.Second) {
+		return fmt.Errorf("circuit_breaker window must be at least 1s")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompareRules tell the comparison engine which differences between legacy
+// and modern JSON bodies do not count as a mismatch. Paths are dotted, e.g.
+// "data.items[].amount": "*" matches any one key or index, "[]" any array
+// index and "**" any number of levels.
+type CompareRules struct {
+	IgnorePaths      []string           `json:"ignore_paths,omitempty" yaml:"ignore_paths"`
+	NumericTolerance map[string]float64 `json:"numeric_tolerance,omitempty" yaml:"numeric_tolerance"` // Path -> largest allowed absolute difference
+	UnorderedArrays  []string           `json:"unordered_arrays,omitempty" yaml:"unordered_arrays"`   // Arrays compared ignoring element order
+}
+
+// DefaultCompareRules apply to migrations without a compare section: fields
+// that always differ between two backends are ignored and money amounts are
+// compared to the same precision the arbiter uses.
+func DefaultCompareRules() CompareRules {
+	return CompareRules{
+		IgnorePaths: []string{"**.timestamp", "**.system", "**.transaction_id"},
+		NumericTolerance: map[string]float64{
+			"**.amount":  0.0001,
+			"**.balance": 0.0001,
+		},
+	}
+}
+
+func (cr *CompareRules) Validate() error {
+	for _, p := range cr.IgnorePaths {
+		if err := validateComparePath(p); err != nil {
+			return fmt.Errorf("compare ignore_paths: %w", err)
+		}
+	}
+	for p, tolerance := range cr.NumericTolerance {
+		if err := validateComparePath(p); err != nil {
+			return fmt.Errorf("compare numeric_tolerance: %w", err)
+		}
+		if tolerance < 0 {
+			return fmt.Errorf("compare numeric_tolerance %q must not be negative", p)
+		}
+	}
+	for _, p := range cr.UnorderedArrays {
+		if err := validateComparePath(p); err != nil {
+			return fmt.Errorf("compare unordered_arrays: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateComparePath(p string) error {
+	if p == "" || strings.HasPrefix(p, ".") || strings.HasSuffix(p, ".") || strings.Contains(p, "..") ||
+		strings.Count(p, "[") != strings.Count(p, "]") {
+		return fmt.Errorf("path %q must be dotted keys, e.g. data.items[].amount", p)
+	}
+	return nil
+}
+
+func (cr *CompareRules) clone() *CompareRules {
+	cp := CompareRules{
+		IgnorePaths:     append([]string(nil), cr.IgnorePaths...),
+		UnorderedArrays: append([]string(nil), cr.UnorderedArrays...),
+	}
+	if cr.NumericTolerance != nil {
+		cp.NumericTolerance = make(map[string]float64, len(cr.NumericTolerance))
+		for p, tolerance := range cr.NumericTolerance {
+			cp.NumericTolerance[p] = tolerance
+		}
+	}
+	return &cp
+}
@@ -1,52 +1,384 @@
 package config
 
-import "sync"
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Migration is one legacy -> modern migration served by the gateway.
+// Requests under PathPrefix are split between LegacyURL and ModernURL
+// according to Weight (0.0 = all legacy, 1.0 = all modern), unless a more
+// specific entry in Routes overrides it.
+type Migration struct {
+	Name          string         `json:"name" yaml:"name"`
+	PathPrefix    string         `json:"path_prefix" yaml:"path_prefix"`
+	LegacyURL     string         `json:"legacy_url" yaml:"legacy_url"`
+	ModernURL     string         `json:"modern_url" yaml:"modern_url"`
+	Weight        float64        `json:"weight" yaml:"weight"`
+	ShadowSample  *float64       `json:"shadow_sample,omitempty" yaml:"shadow_sample"` // Share of requests mirrored; nil mirrors all while 0 < weight < 1
+	TrafficLocked bool           `json:"traffic_locked" yaml:"traffic_locked"`
+	StickyKey     string         `json:"sticky_key,omitempty" yaml:"sticky_key"`         // See ParseStickyKey
+	Timeout       Duration       `json:"timeout,omitempty" yaml:"timeout"`               // Zero uses Config.UpstreamTimeout
+	ShadowTimeout Duration       `json:"shadow_timeout,omitempty" yaml:"shadow_timeout"` // Deadline of the background shadow call; zero uses the shadowed backend's timeout
+	LegacyTimeout Duration       `json:"legacy_timeout,omitempty" yaml:"legacy_timeout"` // Overrides Timeout for legacy calls
+	ModernTimeout Duration       `json:"modern_timeout,omitempty" yaml:"modern_timeout"` // Overrides Timeout for modern calls
+	Fallback      FallbackPolicy `json:"fallback,omitempty" yaml:"fallback"`             // Empty never falls back
+	Upstream      *Upstream      `json:"upstream,omitempty" yaml:"upstream"`             // nil uses the gateway-wide settings
+	Routes        []RouteRule    `json:"routes,omitempty" yaml:"routes"`
+
+	CircuitBreaker *CircuitBreaker `json:"circuit_breaker,omitempty" yaml:"circuit_breaker"` // nil disables the breaker
+	Compare        *CompareRules   `json:"compare,omitempty" yaml:"compare"`                 // nil uses DefaultCompareRules
+	HealthCheck    *HealthCheck    `json:"health_check,omitempty" yaml:"health_check"`       // nil disables probing and failover
+}
 
 type Config struct {
-	PythonWeight  float64
-	PhpWeight     float64
-	TrafficLocked bool
-	Mu            sync.RWMutex
+	Migrations      map[string]*Migration
+	TrafficLocked   bool
+	UpstreamTimeout time.Duration
+	Upstream        Upstream // Gateway-wide connection settings, defaults applied
+	Mu              sync.RWMutex
+
+	// Rollouts are the progressive rollout plans by ID; see rollout.go.
+	Rollouts map[string]*Rollout
+
+	// FilePath is set when migrations come from a config file; the file then
+	// owns the migration list and only weights and locks are restored.
+	FilePath string
+	file     *FileState // The file as last applied
+	applied  bool
+
+	store       StateStore
+	stateSource string
+	persistMu   sync.Mutex
 }
 
 var GlobalConfig = &Config{
-	PythonWeight:  0.1,   // Start with 10% to enable shadowing
-	PhpWeight:     0.1,   // Start with 10% to enable shadowing
-	TrafficLocked: false, // Default to unlocked for development
+	Migrations:      map[string]*Migration{},
+	TrafficLocked:   false, // Default to unlocked for development
+	UpstreamTimeout: 30 * time.Second,
+	Upstream:        Upstream{}.WithDefaults(),
+}
+
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// reservedPrefixes are served by the gateway itself, so no migration may
+// claim them or anything below them.
+var reservedPrefixes = []string{"/admin", "/metrics", "/healthz", "/readyz"}
+
+// ErrMigrationExists is returned by CreateMigration when the name is taken.
+var ErrMigrationExists = errors.New("migration already exists")
+
+// ErrMigrationNotFound is returned by DeleteMigration for an unknown name.
+var ErrMigrationNotFound = errors.New("migration not found")
+
+// ErrFileManaged is returned by migration CRUD while a config file owns the
+// migration list; the next reload would undo the change.
+var ErrFileManaged = errors.New("migrations are managed by the config file")
+
+// DefaultMigrations returns the php and python migrations the gateway has
+// always served, reading backend URLs from the environment.
+func DefaultMigrations() []Migration {
+	return []Migration{
+		{
+			Name:       "php",
+			PathPrefix: "/php",
+			LegacyURL:  envOrDefault("LEGACY_PHP_URL", "http://localhost:8080"),
+			ModernURL:  envOrDefault("MODERN_GO_URL", "http://localhost:8081"),
+			Weight:     0.1, // Start with 10% to enable shadowing
+		},
+		{
+			Name:       "python",
+			PathPrefix: "/python",
+			LegacyURL:  envOrDefault("LEGACY_PYTHON_URL", "http://localhost:5001"),
+			ModernURL:  envOrDefault("MODERN_PYTHON_URL", "http://localhost:5002"),
+			Weight:     0.1, // Start with 10% to enable shadowing
+		},
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Validate checks a migration in isolation. Prefix uniqueness is checked by
+// PutMigration and CreateMigration since it needs the rest of the registry.
+func (m *Migration) Validate() error {
+	if !migrationNamePattern.MatchString(m.Name) {
+		return fmt.Errorf("name %q must be lowercase letters, digits and dashes", m.Name)
+	}
+	if !strings.HasPrefix(m.PathPrefix, "/") || m.PathPrefix == "/" || strings.HasSuffix(m.PathPrefix, "/") {
+		return fmt.Errorf("path_prefix %q must start with / and must not end with /", m.PathPrefix)
+	}
+	for _, reserved := range reservedPrefixes {
+		if m.PathPrefix == reserved || strings.HasPrefix(m.PathPrefix, reserved+"/") {
+			return fmt.Errorf("path_prefix %q is reserved", m.PathPrefix)
+		}
+	}
+	if err := validateBackendURL("legacy_url", m.LegacyURL); err != nil {
+		return err
+	}
+	if err := validateBackendURL("modern_url", m.ModernURL); err != nil {
+		return err
+	}
+	if m.Weight < 0 || m.Weight > 1 {
+		return fmt.Errorf("weight %.2f must be between 0 and 1", m.Weight)
+	}
+	if err := validateShadowSample(m.ShadowSample); err != nil {
+		return err
+	}
+	if m.Timeout < 0 {
+		return fmt.Errorf("timeout %s must not be negative", m.Timeout)
+	}
+	if m.ShadowTimeout < 0 {
+		return fmt.Errorf("shadow_timeout %s must not be negative", m.ShadowTimeout)
+	}
+	if m.LegacyTimeout < 0 || m.ModernTimeout < 0 {
+		return fmt.Errorf("legacy_timeout and modern_timeout must not be negative")
+	}
+	if m.StickyKey != "" {
+		if _, _, err := ParseStickyKey(m.StickyKey); err != nil {
+			return err
+		}
+	}
+	if m.CircuitBreaker != nil {
+		if err := m.CircuitBreaker.Validate(); err != nil {
+			return err
+		}
+	}
+	if m.Compare != nil {
+		if err := m.Compare.Validate(); err != nil {
+			return err
+		}
+	}
+	if m.HealthCheck != nil {
+		if err := m.HealthCheck.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := m.Fallback.Validate(); err != nil {
+		return err
+	}
+	if m.Upstream != nil {
+		if err := m.Upstream.Validate(); err != nil {
+			return err
+		}
+	}
+
+	seen := map[string]bool{}
+	for i := range m.Routes {
+		rr := &m.Routes[i]
+		if err := rr.Validate(); err != nil {
+			return err
+		}
+		if seen[rr.Key()] {
+			return fmt.Errorf("route %s is defined twice", rr.Key())
+		}
+		seen[rr.Key()] = true
+	}
+	return nil
+}
+
+func (m *Migration) clone() Migration {
+	cp := *m
+	cp.Routes = cloneRoutes(m.Routes)
+	cp.ShadowSample = copyFloat(m.ShadowSample)
+	cp.Fallback = m.Fallback.clone()
+	if m.CircuitBreaker != nil {
+		cb := *m.CircuitBreaker
+		cp.CircuitBreaker = &cb
+	}
+	if m.Compare != nil {
+		cp.Compare = m.Compare.clone()
+	}
+	if m.HealthCheck != nil {
+		hc := *m.HealthCheck
+		cp.HealthCheck = &hc
+	}
+	if m.Upstream != nil {
+		u := *m.Upstream
+		cp.Upstream = &u
+	}
+	return cp
+}
+
+func validateBackendURL(field, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s %q must be an absolute http(s) URL", field, raw)
+	}
+	return nil
+}
+
+// PutMigration creates or replaces the migration with m.Name.
+func (c *Config) PutMigration(m Migration) error {
+	return c.storeMigration(m, false)
 }
 
-func (c *Config) GetPythonWeight() float64 {
+// CreateMigration adds m, or returns ErrMigrationExists if a migration with
+// m.Name is already registered. The check and the write hold the same lock,
+// so of two concurrent creates with one name only the first succeeds.
+func (c *Config) CreateMigration(m Migration) error {
+	return c.storeMigration(m, true)
+}
+
+func (c *Config) storeMigration(m Migration, create bool) error {
+	m.LegacyURL = strings.TrimSuffix(m.LegacyURL, "/")
+	m.ModernURL = strings.TrimSuffix(m.ModernURL, "/")
+	m.Routes = cloneRoutes(m.Routes)
+	for i := range m.Routes {
+		m.Routes[i].Method = strings.ToUpper(m.Routes[i].Method)
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if c.FilePath != "" {
+		return ErrFileManaged
+	}
+	if _, exists := c.Migrations[m.Name]; exists && create {
+		return ErrMigrationExists
+	}
+	for name, existing := range c.Migrations {
+		if name != m.Name && existing.PathPrefix == m.PathPrefix {
+			return fmt.Errorf("path_prefix %q is already used by %q", m.PathPrefix, name)
+		}
+	}
+
+	c.Migrations[m.Name] = &m
+	return nil
+}
+
+// GetMigration returns a copy of the named migration.
+func (c *Config) GetMigration(name string) (Migration, bool) {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	m, ok := c.Migrations[name]
+	if !ok {
+		return Migration{}, false
+	}
+	return m.clone(), true
+}
+
+// ListMigrations returns copies of all migrations sorted by name.
+func (c *Config) ListMigrations() []Migration {
 	c.Mu.RLock()
 	defer c.Mu.RUnlock()
-	return c.PythonWeight
+	return c.listMigrationsLocked()
+}
+
+func (c *Config) listMigrationsLocked() []Migration {
+	list := make([]Migration, 0, len(c.Migrations))
+	for _, m := range c.Migrations {
+		list = append(list, m.clone())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
 }
 
-func (c *Config) SetPythonWeight(weight float64) {
+func (c *Config) DeleteMigration(name string) error {
 	c.Mu.Lock()
 	defer c.Mu.Unlock()
-	c.PythonWeight = weight
+	if c.FilePath != "" {
+		return ErrFileManaged
+	}
+	if _, ok := c.Migrations[name]; !ok {
+		return ErrMigrationNotFound
+	}
+	delete(c.Migrations, name)
+	return nil
 }
 
-func (c *Config) GetPhpWeight() float64 {
+// MatchMigration finds the migration with the longest prefix owning path and
+// returns it together with the remainder of the path after the prefix.
+func (c *Config) MatchMigration(path string) (Migration, string, bool) {
 	c.Mu.RLock()
 	defer c.Mu.RUnlock()
-	return c.PhpWeight
+
+	var best *Migration
+	for _, m := range c.Migrations {
+		if path != m.PathPrefix && !strings.HasPrefix(path, m.PathPrefix+"/") {
+			continue
+		}
+		if best == nil || len(m.PathPrefix) > len(best.PathPrefix) {
+			best = m
+		}
+	}
+	if best == nil {
+		return Migration{}, "", false
+	}
+	return best.clone(), strings.TrimPrefix(path, best.PathPrefix), true
 }
 
-func (c *Config) SetPhpWeight(weight float64) {
+// SetWeight sets the service-level weight and returns the previous one.
+// While a rollout plan drives that weight it returns ErrRolloutActive.
+func (c *Config) SetWeight(name string, weight float64) (float64, error) {
+	if weight < 0 || weight > 1 {
+		return 0, fmt.Errorf("weight %.2f must be between 0 and 1", weight)
+	}
 	c.Mu.Lock()
 	defer c.Mu.Unlock()
-	c.PhpWeight = weight
+	m, ok := c.Migrations[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown service %q", name)
+	}
+	if err := c.checkNoRolloutLocked(name, ""); err != nil {
+		return 0, err
+	}
+	old := m.Weight
+	m.Weight = weight
+	return old, nil
 }
 
+// IsTrafficLocked reports the global lock, which applies to every migration.
 func (c *Config) IsTrafficLocked() bool {
 	c.Mu.RLock()
 	defer c.Mu.RUnlock()
 	return c.TrafficLocked
 }
 
-func (c *Config) SetTrafficLocked(locked bool) {
+// SetTrafficLocked sets the global lock and returns the previous value.
+func (c *Config) SetTrafficLocked(locked bool) bool {
 	c.Mu.Lock()
 	defer c.Mu.Unlock()
+	old := c.TrafficLocked
 	c.TrafficLocked = locked
+	return old
+}
+
+// IsMigrationLocked reports whether traffic to the named migration is locked,
+// either by its own lock or by the global one.
+func (c *Config) IsMigrationLocked(name string) bool {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	if c.TrafficLocked {
+		return true
+	}
+	m, ok := c.Migrations[name]
+	return ok && m.TrafficLocked
+}
+
+// SetMigrationLocked sets the service lock and returns the previous value.
+func (c *Config) SetMigrationLocked(name string, locked bool) (bool, error) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	m, ok := c.Migrations[name]
+	if !ok {
+		return false, fmt.Errorf("unknown service %q", name)
+	}
+	old := m.TrafficLocked
+	m.TrafficLocked = locked
+	return old, nil
 }
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCreateMigrationConcurrentSameName(t *testing.T) {
+	c := &Config{Migrations: map[string]*Migration{}}
+	m := Migration{
+		Name:       "billing",
+		PathPrefix: "/billing",
+		LegacyURL:  "http://legacy:8080",
+		ModernURL:  "http://modern:8080",
+	}
+
+	const callers = 16
+	errs := make(chan error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.CreateMigration(m)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrMigrationExists):
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d creates succeeded; want 1", created)
+	}
+}
+
+func TestApplyFileKeepsLiveWeight(t *testing.T) {
+	c := &Config{Migrations: map[string]*Migration{}}
+	fc := &FileConfig{Migrations: []Migration{{
+		Name:       "billing",
+		PathPrefix: "/billing",
+		LegacyURL:  "http://legacy:8080",
+		ModernURL:  "http://modern:8080",
+		Weight:     0.1,
+	}}}
+	c.ApplyFile("gateway.yaml", fc)
+	if _, err := c.SetWeight("billing", 0.4); err != nil {
+		t.Fatal(err)
+	}
+
+	c.ApplyFile("gateway.yaml", fc)
+	if m, _ := c.GetMigration("billing"); m.Weight != 0.4 {
+		t.Fatalf("weight %.2f after reload; want the live 0.40", m.Weight)
+	}
+}
+
+func fileWithRoutes(weight float64, routes ...RouteRule) *FileConfig {
+	return &FileConfig{Migrations: []Migration{{
+		Name:       "billing",
+		PathPrefix: "/billing",
+		LegacyURL:  "http://legacy:8080",
+		ModernURL:  "http://modern:8080",
+		Weight:     weight,
+		Routes:     routes,
+	}}}
+}
+
+func TestApplyFileReload(t *testing.T) {
+	half := 0.5
+	transfers := RouteRule{Method: "POST", Path: "/transfers", Weight: &half}
+	c := &Config{Migrations: map[string]*Migration{}}
+	c.ApplyFile("gateway.yaml", fileWithRoutes(0.1, transfers))
+	if _, err := c.SetRouteWeight("billing", "GET", "/invoices", 0.3); err != nil {
+		t.Fatal(err)
+	}
+
+	// An edited weight wins over the live one, a removed route is gone and
+	// the route added through the admin API stays
+	c.ApplyFile("gateway.yaml", fileWithRoutes(0.2))
+	m, _ := c.GetMigration("billing")
+	if m.Weight != 0.2 {
+		t.Fatalf("weight %.2f after editing the file; want 0.20", m.Weight)
+	}
+	if m.findRoute("POST", "/transfers") != nil {
+		t.Fatal("route removed from the file survived the reload")
+	}
+	if rule := m.findRoute("GET", "/invoices"); rule == nil || *rule.Weight != 0.3 {
+		t.Fatalf("admin route %+v after reload; want weight 0.30", rule)
+	}
+
+	if err := c.CreateMigration(Migration{Name: "ledger", PathPrefix: "/ledger", LegacyURL: "http://legacy:8080", ModernURL: "http://modern:8080"}); !errors.Is(err, ErrFileManaged) {
+		t.Fatalf("CreateMigration with a config file: %v; want ErrFileManaged", err)
+	}
+}
+
+type memoryStore struct{ saved *Snapshot }
+
+func (s *memoryStore) Load() (*Snapshot, error)  { return s.saved, nil }
+func (s *memoryStore) Save(snap *Snapshot) error { s.saved = snap; return nil }
+func (s *memoryStore) String() string            { return "memory" }
+
+func TestUseStoreAppliesFileEditsMadeWhileStopped(t *testing.T) {
+	store := &memoryStore{}
+	c := &Config{Migrations: map[string]*Migration{}}
+	c.ApplyFile("gateway.yaml", fileWithRoutes(0.1))
+	if err := c.UseStore(store); err != nil {
+		t.Fatal(err)
+	}
+	c.SetWeight("billing", 0.4)
+	c.SetTrafficLocked(true)
+	if err := c.Persist(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart with the weight edited in the file: the edit wins, the lock
+	// the file never mentioned is restored
+	restarted := &Config{Migrations: map[string]*Migration{}}
+	restarted.ApplyFile("gateway.yaml", fileWithRoutes(0.2))
+	if err := restarted.UseStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := restarted.GetMigration("billing"); m.Weight != 0.2 {
+		t.Fatalf("weight %.2f after restart; want the edited 0.20", m.Weight)
+	}
+	if !restarted.TrafficLocked {
+		t.Fatal("global lock was not restored")
+	}
+}
+
+func TestSetWeightRejectedWhileRolloutActive(t *testing.T) {
+	c := &Config{Migrations: map[string]*Migration{"billing": {Name: "billing", Weight: 0.1}}}
+	now := time.Now()
+	if _, err := c.StartRollout(Rollout{
+		ID:      "ro-1",
+		Service: "billing",
+		Steps:   []RolloutStep{{Weight: 0.2}, {Weight: 0.5}},
+	}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.SetWeight("billing", 0.9); !errors.Is(err, ErrRolloutActive) {
+		t.Fatalf("SetWeight during a rollout: %v; want ErrRolloutActive", err)
+	}
+	// A route weight is not the one the plan drives
+	if _, err := c.SetRouteWeight("billing", "GET", "/invoices", 0.3); err != nil {
+		t.Fatalf("SetRouteWeight on another weight: %v", err)
+	}
+
+	if _, _, err := c.AbortRollout("ro-1", false, "manual", now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetWeight("billing", 0.9); err != nil {
+		t.Fatalf("SetWeight after abort: %v", err)
+	}
+}
+
+func TestValidateReservedPrefixes(t *testing.T) {
+	for _, prefix := range []string{"/admin", "/admin/x", "/metrics", "/healthz", "/readyz", "/readyz/v2"} {
+		m := Migration{Name: "svc", PathPrefix: prefix, LegacyURL: "http://legacy:8080", ModernURL: "http://modern:8080"}
+		if err := m.Validate(); err == nil {
+			t.Errorf("path_prefix %q accepted; want it reserved", prefix)
+		}
+	}
+	m := Migration{Name: "svc", PathPrefix: "/metrics-api", LegacyURL: "http://legacy:8080", ModernURL: "http://modern:8080"}
+	if err := m.Validate(); err != nil {
+		t.Errorf("path_prefix /metrics-api rejected: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import "fmt"
+
+// Failures a FallbackPolicy can fall back on.
+const (
+	FallbackNever           = "never"
+	FallbackConnectionError = "connection_error" // No response: refused, reset, DNS, TLS
+	FallbackTimeout         = "timeout"
+	Fallback5xx             = "5xx"
+)
+
+// FallbackPolicy lists the primary failures after which a shadowing-mode
+// request is answered by the other backend instead, e.g.
+// ["connection_error", "timeout"]. A route's policy replaces the service's;
+// nil inherits it and ["never"] turns fallback off.
+type FallbackPolicy []string
+
+// Allows reports whether the policy falls back on failure.
+func (p FallbackPolicy) Allows(failure string) bool {
+	for _, f := range p {
+		if f == failure {
+			return true
+		}
+	}
+	return false
+}
+
+func (p FallbackPolicy) Validate() error {
+	for _, f := range p {
+		switch f {
+		case FallbackNever:
+			if len(p) > 1 {
+				return fmt.Errorf("fallback %q cannot be combined with other failures", FallbackNever)
+			}
+		case FallbackConnectionError, FallbackTimeout, Fallback5xx:
+		default:
+			return fmt.Errorf("unknown fallback %q (want %s, %s, %s or %s)", f,
+				FallbackNever, FallbackConnectionError, FallbackTimeout, Fallback5xx)
+		}
+	}
+	return nil
+}
+
+func (p FallbackPolicy) clone() FallbackPolicy {
+	if p == nil {
+		return nil
+	}
+	return append(FallbackPolicy{}, p...)
+}
@@ -0,0 +1,573 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig is the declarative gateway configuration, read from YAML or JSON.
+// ${VAR} references are expanded from the environment before parsing.
+type FileConfig struct {
+	Listen          string        `json:"listen" yaml:"listen"`
+	StateStore      string        `json:"state_store" yaml:"state_store"`
+	AuditLog        string        `json:"audit_log" yaml:"audit_log"` // NDJSON file; empty keeps the trail in memory only
+	UpstreamTimeout Duration      `json:"upstream_timeout" yaml:"upstream_timeout"`
+	Upstream        Upstream      `json:"upstream" yaml:"upstream"`
+	TrafficLocked   bool          `json:"traffic_locked" yaml:"traffic_locked"`
+	Events          EventsFile    `json:"events" yaml:"events"`
+	AdminAuth       AdminAuthFile `json:"admin_auth" yaml:"admin_auth"`
+	TLS             TLSFile       `json:"tls" yaml:"tls"`
+	Tracing         TracingFile   `json:"tracing" yaml:"tracing"`
+	Logging         LoggingFile   `json:"logging" yaml:"logging"`
+	Shutdown        ShutdownFile  `json:"shutdown" yaml:"shutdown"`
+	Migrations      []Migration   `json:"migrations" yaml:"migrations"`
+}
+
+// EventsFile configures where shadow comparison and audit events are sent.
+// Every configured sink receives every event.
+type EventsFile struct {
+	Kafka   KafkaFile     `json:"kafka" yaml:"kafka"`
+	File    EventFileSink `json:"file" yaml:"file"`
+	Stdout  bool          `json:"stdout" yaml:"stdout"`
+	Webhook WebhookFile   `json:"webhook" yaml:"webhook"`
+	Memory  int           `json:"memory" yaml:"memory"` // Recent events kept for GET /admin/events
+}
+
+// KafkaFile holds the broker list and the topic names. The topic names are
+// used by every sink, not only Kafka. While the brokers are unreachable,
+// events wait in the Outbox file.
+type KafkaFile struct {
+	BootstrapServers string   `json:"bootstrap_servers" yaml:"bootstrap_servers"`
+	Topic            string   `json:"topic" yaml:"topic"`
+	AuditTopic       string   `json:"audit_topic" yaml:"audit_topic"`
+	StateTopic       string   `json:"state_topic" yaml:"state_topic"`       // After shadowed writes; empty disables them
+	FailoverTopic    string   `json:"failover_topic" yaml:"failover_topic"` // When a request fails over; empty disables them
+	Outbox           string   `json:"outbox" yaml:"outbox"`                 // Empty drops events while Kafka is down
+	OutboxMaxMB      int      `json:"outbox_max_mb" yaml:"outbox_max_mb"`
+	FlushTimeout     Duration `json:"flush_timeout" yaml:"flush_timeout"` // How long shutdown waits for queued events
+}
+
+// EventFileSink appends events to an NDJSON file, rotating it at MaxSizeMB.
+type EventFileSink struct {
+	Path       string `json:"path" yaml:"path"`
+	MaxSizeMB  int    `json:"max_size_mb" yaml:"max_size_mb"` // 0 never rotates
+	MaxBackups int    `json:"max_backups" yaml:"max_backups"`
+}
+
+// WebhookFile POSTs every event to URL.
+type WebhookFile struct {
+	URL     string            `json:"url" yaml:"url"`
+	Timeout Duration          `json:"timeout" yaml:"timeout"`
+	Headers map[string]string `json:"headers" yaml:"headers"`
+}
+
+// AdminAuthFile lists who may call the admin API. Roles are "viewer"
+// (read-only) or "operator". With nothing listed the admin API is open.
+type AdminAuthFile struct {
+	Tokens      []AdminToken      `json:"tokens" yaml:"tokens"`
+	HMACKeys    []AdminHMACKey    `json:"hmac_keys" yaml:"hmac_keys"`
+	ClientCerts []AdminClientCert `json:"client_certs" yaml:"client_certs"`
+}
+
+type AdminToken struct {
+	Name  string `json:"name" yaml:"name"`
+	Role  string `json:"role" yaml:"role"`
+	Token string `json:"token" yaml:"token"`
+}
+
+type AdminHMACKey struct {
+	KeyID  string `json:"key_id" yaml:"key_id"`
+	Name   string `json:"name" yaml:"name"`
+	Role   string `json:"role" yaml:"role"`
+	Secret string `json:"secret" yaml:"secret"`
+}
+
+type AdminClientCert struct {
+	CommonName string `json:"common_name" yaml:"common_name"`
+	Role       string `json:"role" yaml:"role"`
+}
+
+// TLSFile serves the gateway over TLS. With ClientCAFile set, client
+// certificates signed by that CA are verified when presented.
+type TLSFile struct {
+	CertFile     string `json:"cert_file" yaml:"cert_file"`
+	KeyFile      string `json:"key_file" yaml:"key_file"`
+	ClientCAFile string `json:"client_ca_file" yaml:"client_ca_file"`
+}
+
+// TracingFile exports OpenTelemetry spans for proxied requests. Exporter is
+// "otlp" (OTLP over HTTP to Endpoint), "file" (one JSON span per line in
+// File) or "none".
+type TracingFile struct {
+	Exporter    string            `json:"exporter" yaml:"exporter"`
+	Endpoint    string            `json:"endpoint" yaml:"endpoint"` // host:port; empty uses OTEL_EXPORTER_OTLP_ENDPOINT
+	Insecure    bool              `json:"insecure" yaml:"insecure"` // Plain HTTP to the collector
+	Headers     map[string]string `json:"headers" yaml:"headers"`
+	File        string            `json:"file" yaml:"file"`
+	ServiceName string            `json:"service_name" yaml:"service_name"`
+	SampleRatio float64           `json:"sample_ratio" yaml:"sample_ratio"` // Share of new traces recorded; callers' sampling decisions are kept
+}
+
+// LoggingFile sets the log level ("debug", "info", "warn" or "error") and
+// format ("json" or "text"). Request and response bodies are only logged at
+// debug, with the values of RedactFields masked.
+type LoggingFile struct {
+	Level        string   `json:"level" yaml:"level"`
+	Format       string   `json:"format" yaml:"format"`
+	RedactFields []string `json:"redact_fields" yaml:"redact_fields"` // JSON keys at any depth, case-insensitive
+}
+
+// ShutdownFile controls draining on SIGTERM/SIGINT. /readyz reports
+// draining for DrainDelay while requests are still served, so load balancers
+// stop sending new ones; then in-flight requests and shadow calls get up to
+// Timeout to finish before events are flushed.
+type ShutdownFile struct {
+	DrainDelay Duration `json:"drain_delay" yaml:"drain_delay"`
+	Timeout    Duration `json:"timeout" yaml:"timeout"`
+}
+
+// DefaultRedactFields are masked in logged bodies unless the config lists
+// its own.
+var DefaultRedactFields = []string{"balance", "account_number", "password", "token", "secret", "pin", "card_number", "cvv", "ssn"}
+
+// DefaultFileConfig is the configuration used when no file is given, built
+// from the environment variables the gateway has always read.
+func DefaultFileConfig() *FileConfig {
+	return &FileConfig{
+		Listen:          ":8082",
+		StateStore:      os.Getenv("GATEWAY_STATE_STORE"),
+		AuditLog:        os.Getenv("GATEWAY_AUDIT_LOG"),
+		UpstreamTimeout: Duration(30 * time.Second),
+		Events: EventsFile{
+			Kafka: KafkaFile{
+				BootstrapServers: os.Getenv("KAFKA_BOOTSTRAP_SERVERS"),
+				Topic:            "shadow-requests",
+				AuditTopic:       "gateway-audit",
+				StateTopic:       "db-state-updates",
+				FailoverTopic:    "gateway-failovers",
+				Outbox:           kafkaOutboxFromEnv(),
+				OutboxMaxMB:      64,
+				FlushTimeout:     Duration(10 * time.Second),
+			},
+			File: EventFileSink{
+				Path:       os.Getenv("GATEWAY_EVENTS_FILE"),
+				MaxSizeMB:  100,
+				MaxBackups: 5,
+			},
+			Stdout: os.Getenv("GATEWAY_EVENTS_STDOUT") == "true" || os.Getenv("GATEWAY_EVENTS_STDOUT") == "1",
+			Webhook: WebhookFile{
+				URL:     os.Getenv("GATEWAY_EVENTS_WEBHOOK"),
+				Timeout: Duration(5 * time.Second),
+			},
+		},
+		AdminAuth: AdminAuthFile{
+			Tokens: adminTokensFromEnv(os.Getenv("GATEWAY_ADMIN_TOKENS")),
+		},
+		Tracing: TracingFile{
+			Exporter:    tracingExporterFromEnv(),
+			File:        os.Getenv("GATEWAY_TRACING_FILE"),
+			ServiceName: "phoenix-gateway",
+			SampleRatio: 1,
+		},
+		Logging: LoggingFile{
+			Level:        envOrDefault("GATEWAY_LOG_LEVEL", "info"),
+			Format:       envOrDefault("GATEWAY_LOG_FORMAT", "json"),
+			RedactFields: DefaultRedactFields,
+		},
+		Shutdown: ShutdownFile{
+			Timeout: Duration(30 * time.Second),
+		},
+		Migrations: DefaultMigrations(),
+	}
+}
+
+func kafkaOutboxFromEnv() string {
+	if path := os.Getenv("GATEWAY_KAFKA_OUTBOX"); path != "" {
+		return path
+	}
+	return filepath.Join(os.TempDir(), "phoenix-gateway-outbox.ndjson")
+}
+
+// tracingExporterFromEnv picks the exporter from GATEWAY_TRACING_EXPORTER,
+// or otlp when the standard OTEL_EXPORTER_OTLP_ENDPOINT is set.
+func tracingExporterFromEnv() string {
+	if exporter := os.Getenv("GATEWAY_TRACING_EXPORTER"); exporter != "" {
+		return exporter
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		return "otlp"
+	}
+	return "none"
+}
+
+// adminTokensFromEnv parses "name:role:token,name:role:token". Malformed
+// entries are kept with an empty role so Validate reports them.
+func adminTokensFromEnv(raw string) []AdminToken {
+	var tokens []AdminToken
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			tokens = append(tokens, AdminToken{Name: parts[0]})
+			continue
+		}
+		tokens = append(tokens, AdminToken{Name: parts[0], Role: parts[1], Token: parts[2]})
+	}
+	return tokens
+}
+
+// LoadFile reads and validates a gateway config file. Fields left out keep
+// the values from DefaultFileConfig, except migrations, which the file must
+// list in full.
+func LoadFile(path string) (*FileConfig, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(os.ExpandEnv(string(raw)))
+
+	fc := DefaultFileConfig()
+	fc.Migrations = nil
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(fc)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(fc)
+	default:
+		return nil, fmt.Errorf("%s: config file must end in .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := fc.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fc, nil
+}
+
+// Validate checks the whole file and reports the first problem with enough
+// context to find it.
+func (fc *FileConfig) Validate() error {
+	if fc.Listen == "" {
+		return fmt.Errorf("listen must be set, e.g. \":8082\"")
+	}
+	if fc.UpstreamTimeout <= 0 {
+		return fmt.Errorf("upstream_timeout must be positive")
+	}
+	if err := fc.Upstream.Validate(); err != nil {
+		return err
+	}
+	if err := fc.Events.Validate(); err != nil {
+		return err
+	}
+	if len(fc.Migrations) == 0 {
+		return fmt.Errorf("migrations must list at least one migration")
+	}
+	if err := fc.validateAdminAuth(); err != nil {
+		return err
+	}
+	if err := fc.Tracing.Validate(); err != nil {
+		return err
+	}
+	if err := fc.Logging.Validate(); err != nil {
+		return err
+	}
+	if fc.Shutdown.DrainDelay < 0 || fc.Shutdown.Timeout <= 0 {
+		return fmt.Errorf("shutdown.drain_delay must not be negative and shutdown.timeout must be positive")
+	}
+
+	names := map[string]bool{}
+	prefixes := map[string]string{}
+	for i := range fc.Migrations {
+		m := &fc.Migrations[i]
+		m.LegacyURL = strings.TrimSuffix(m.LegacyURL, "/")
+		m.ModernURL = strings.TrimSuffix(m.ModernURL, "/")
+		for j := range m.Routes {
+			m.Routes[j].Method = strings.ToUpper(m.Routes[j].Method)
+		}
+
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("migrations[%d] (%s): %w", i, m.Name, err)
+		}
+		if names[m.Name] {
+			return fmt.Errorf("migrations[%d]: name %q is used twice", i, m.Name)
+		}
+		if other, ok := prefixes[m.PathPrefix]; ok {
+			return fmt.Errorf("migrations[%d] (%s): path_prefix %q is already used by %q", i, m.Name, m.PathPrefix, other)
+		}
+		names[m.Name] = true
+		prefixes[m.PathPrefix] = m.Name
+	}
+	return nil
+}
+
+func (ev *EventsFile) Validate() error {
+	if ev.Kafka.Topic == "" {
+		return fmt.Errorf("events.kafka.topic must be set")
+	}
+	if ev.Kafka.Outbox != "" && ev.Kafka.OutboxMaxMB <= 0 {
+		return fmt.Errorf("events.kafka.outbox_max_mb must be positive")
+	}
+	if ev.Kafka.FlushTimeout < 0 {
+		return fmt.Errorf("events.kafka.flush_timeout must not be negative")
+	}
+	if ev.File.MaxSizeMB < 0 || ev.File.MaxBackups < 0 {
+		return fmt.Errorf("events.file.max_size_mb and max_backups must not be negative")
+	}
+	if ev.Webhook.URL != "" && !strings.HasPrefix(ev.Webhook.URL, "http://") && !strings.HasPrefix(ev.Webhook.URL, "https://") {
+		return fmt.Errorf("events.webhook.url %q must start with http:// or https://", ev.Webhook.URL)
+	}
+	if ev.Webhook.Timeout < 0 {
+		return fmt.Errorf("events.webhook.timeout must not be negative")
+	}
+	if ev.Memory < 0 {
+		return fmt.Errorf("events.memory must not be negative")
+	}
+	return nil
+}
+
+func (tr *TracingFile) Validate() error {
+	switch tr.Exporter {
+	case "", "none", "otlp":
+	case "file":
+		if tr.File == "" {
+			return fmt.Errorf("tracing.file must be set for the file exporter")
+		}
+	default:
+		return fmt.Errorf("tracing.exporter %q must be otlp, file or none", tr.Exporter)
+	}
+	if tr.SampleRatio < 0 || tr.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+func (lg *LoggingFile) Validate() error {
+	switch strings.ToLower(lg.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("logging.level %q must be debug, info, warn or error", lg.Level)
+	}
+	if lg.Format != "json" && lg.Format != "text" {
+		return fmt.Errorf("logging.format %q must be json or text", lg.Format)
+	}
+	return nil
+}
+
+func (fc *FileConfig) validateAdminAuth() error {
+	for i, t := range fc.AdminAuth.Tokens {
+		if t.Name == "" || t.Token == "" {
+			return fmt.Errorf("admin_auth.tokens[%d]: name and token must be set", i)
+		}
+		if err := validateRole(t.Role); err != nil {
+			return fmt.Errorf("admin_auth.tokens[%d] (%s): %w", i, t.Name, err)
+		}
+	}
+	for i, k := range fc.AdminAuth.HMACKeys {
+		if k.KeyID == "" || k.Secret == "" {
+			return fmt.Errorf("admin_auth.hmac_keys[%d]: key_id and secret must be set", i)
+		}
+		if err := validateRole(k.Role); err != nil {
+			return fmt.Errorf("admin_auth.hmac_keys[%d] (%s): %w", i, k.KeyID, err)
+		}
+	}
+	for i, c := range fc.AdminAuth.ClientCerts {
+		if c.CommonName == "" {
+			return fmt.Errorf("admin_auth.client_certs[%d]: common_name must be set", i)
+		}
+		if err := validateRole(c.Role); err != nil {
+			return fmt.Errorf("admin_auth.client_certs[%d] (%s): %w", i, c.CommonName, err)
+		}
+	}
+
+	if (fc.TLS.CertFile == "") != (fc.TLS.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	if len(fc.AdminAuth.ClientCerts) > 0 && (fc.TLS.ClientCAFile == "" || fc.TLS.CertFile == "") {
+		return fmt.Errorf("admin_auth.client_certs needs tls.cert_file, tls.key_file and tls.client_ca_file")
+	}
+	return nil
+}
+
+func validateRole(role string) error {
+	if role != "viewer" && role != "operator" {
+		return fmt.Errorf("role %q must be viewer or operator", role)
+	}
+	return nil
+}
+
+// FileState is what the config file said the last time it was applied. A
+// reload compares against it to tell a value edited in the file apart from
+// one changed at runtime through the admin API.
+type FileState struct {
+	TrafficLocked bool        `json:"traffic_locked"`
+	Migrations    []Migration `json:"migrations"`
+}
+
+func newFileState(fc *FileConfig) *FileState {
+	fs := &FileState{TrafficLocked: fc.TrafficLocked, Migrations: make([]Migration, len(fc.Migrations))}
+	for i := range fc.Migrations {
+		fs.Migrations[i] = fc.Migrations[i].clone()
+	}
+	return fs
+}
+
+func (fs *FileState) clone() *FileState {
+	if fs == nil {
+		return nil
+	}
+	cp := &FileState{TrafficLocked: fs.TrafficLocked, Migrations: make([]Migration, len(fs.Migrations))}
+	for i := range fs.Migrations {
+		cp.Migrations[i] = fs.Migrations[i].clone()
+	}
+	return cp
+}
+
+func (fs *FileState) find(name string) *Migration {
+	for i := range fs.Migrations {
+		if fs.Migrations[i].Name == name {
+			return &fs.Migrations[i]
+		}
+	}
+	return nil
+}
+
+// ApplyFile swaps in the migrations and timeouts from fc in one step.
+// Weights, shadow sampling and locks edited in the file since the last
+// apply take effect; values the file left alone keep their live setting,
+// so a reload never undoes a ramp that happened through the admin API.
+// Routes removed from the file are dropped. Requests in flight keep the
+// RouteTarget they resolved before the swap. The live state is read under
+// the same lock as the swap, so an admin change made meanwhile is carried
+// over rather than lost.
+func (c *Config) ApplyFile(path string, fc *FileConfig) {
+	file := newFileState(fc)
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	c.UpstreamTimeout = time.Duration(fc.UpstreamTimeout)
+	c.Upstream = fc.Upstream.WithDefaults()
+	c.FilePath = path
+	if c.applied {
+		c.mergeFileLocked(c.file, c.snapshotLocked(), file)
+	} else {
+		c.Migrations = make(map[string]*Migration, len(file.Migrations))
+		for i := range file.Migrations {
+			m := file.Migrations[i].clone()
+			c.Migrations[m.Name] = &m
+		}
+		c.TrafficLocked = file.TrafficLocked
+		c.applied = true
+	}
+	c.file = file
+}
+
+// mergeFileLocked rebuilds the migrations from next, the file being
+// applied, carrying over the runtime state in live. A value is taken from
+// next when it differs from prev, the file as last applied; otherwise the
+// live value wins. With prev nil (state saved before file tracking) every
+// live value wins. Route rules missing from next are kept only if prev did
+// not have them either, i.e. they were added through the admin API. Rollout
+// plans are restored from live. Callers must hold c.Mu.
+func (c *Config) mergeFileLocked(prev *FileState, live *Snapshot, next *FileState) {
+	known := prev != nil
+	c.TrafficLocked = next.TrafficLocked
+	if !known || prev.TrafficLocked == next.TrafficLocked {
+		c.TrafficLocked = live.TrafficLocked
+	}
+	c.restoreRollouts(live.Rollouts)
+
+	liveByName := make(map[string]*Migration, len(live.Migrations))
+	for i := range live.Migrations {
+		liveByName[live.Migrations[i].Name] = &live.Migrations[i]
+	}
+
+	c.Migrations = make(map[string]*Migration, len(next.Migrations))
+	for i := range next.Migrations {
+		m := next.Migrations[i].clone()
+		if lm, ok := liveByName[m.Name]; ok {
+			var pm *Migration
+			if known {
+				pm = prev.find(m.Name)
+			}
+			m.mergeLive(lm, pm, known)
+		}
+		c.Migrations[m.Name] = &m
+	}
+}
+
+// mergeLive applies mergeFileLocked's rules to one migration: m is the
+// file's version, live the running one and prev the file's version as last
+// applied (nil if the migration is new to the file or known is false).
+func (m *Migration) mergeLive(live, prev *Migration, known bool) {
+	if !known || prev != nil {
+		if !known || m.Weight == prev.Weight {
+			m.Weight = live.Weight
+		}
+		if !known || sameFloat(m.ShadowSample, prev.ShadowSample) {
+			m.ShadowSample = copyFloat(live.ShadowSample)
+		}
+		if !known || m.TrafficLocked == prev.TrafficLocked {
+			m.TrafficLocked = live.TrafficLocked
+		}
+	}
+
+	for i := range m.Routes {
+		rule := &m.Routes[i]
+		liveRule := live.findRoute(rule.Method, rule.Path)
+		if liveRule == nil {
+			continue
+		}
+		var prevRule *RouteRule
+		if prev != nil {
+			prevRule = prev.findRoute(rule.Method, rule.Path)
+		}
+		if known && prevRule == nil {
+			continue
+		}
+		if !known || sameFloat(rule.Weight, prevRule.Weight) {
+			rule.Weight = copyFloat(liveRule.Weight)
+		}
+		if !known || sameFloat(rule.ShadowSample, prevRule.ShadowSample) {
+			rule.ShadowSample = copyFloat(liveRule.ShadowSample)
+		}
+		if !known || rule.TrafficLocked == prevRule.TrafficLocked {
+			rule.TrafficLocked = liveRule.TrafficLocked
+		}
+	}
+
+	for _, liveRule := range live.Routes {
+		if m.findRoute(liveRule.Method, liveRule.Path) != nil {
+			continue
+		}
+		if prev != nil && prev.findRoute(liveRule.Method, liveRule.Path) != nil {
+			continue // removed from the file
+		}
+		m.Routes = append(m.Routes, liveRule.clone())
+	}
+}
+
+func sameFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
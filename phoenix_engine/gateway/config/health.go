@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HealthCheck actively probes a migration's legacy and modern backends. A
+// backend turns unhealthy after UnhealthyThreshold failed probes in a row
+// and healthy again after HealthyThreshold successful ones; a probe
+// succeeds on any 2xx or 3xx answer within Timeout. The health state
+// itself lives in the health package.
+type HealthCheck struct {
+	Path               string   `json:"path" yaml:"path"`                                         // Probed on both backends, e.g. /health
+	LegacyPath         string   `json:"legacy_path,omitempty" yaml:"legacy_path"`                 // Overrides Path for legacy
+	ModernPath         string   `json:"modern_path,omitempty" yaml:"modern_path"`                 // Overrides Path for modern
+	Interval           Duration `json:"interval,omitempty" yaml:"interval"`                       // Default 5s
+	Timeout            Duration `json:"timeout,omitempty" yaml:"timeout"`                         // Default 2s
+	HealthyThreshold   int      `json:"healthy_threshold,omitempty" yaml:"healthy_threshold"`     // Default 2
+	UnhealthyThreshold int      `json:"unhealthy_threshold,omitempty" yaml:"unhealthy_threshold"` // Default 3
+}
+
+// WithDefaults returns hc with zero settings replaced by their defaults.
+func (hc HealthCheck) WithDefaults() HealthCheck {
+	if hc.Interval == 0 {
+		hc.Interval = Duration(5 * time.Second)
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = Duration(2 * time.Second)
+	}
+	if hc.HealthyThreshold == 0 {
+		hc.HealthyThreshold = 2
+	}
+	if hc.UnhealthyThreshold == 0 {
+		hc.UnhealthyThreshold = 3
+	}
+	return hc
+}
+
+// PathFor is the probe path for "legacy" or "modern".
+func (hc HealthCheck) PathFor(backend string) string {
+	if backend == "legacy" && hc.LegacyPath != "" {
+		return hc.LegacyPath
+	}
+	if backend == "modern" && hc.ModernPath != "" {
+		return hc.ModernPath
+	}
+	return hc.Path
+}
+
+func (hc *HealthCheck) Validate() error {
+	for _, backend := range []string{"legacy", "modern"} {
+		path := hc.PathFor(backend)
+		if path == "" {
+			return fmt.Errorf("health_check needs path or %s_path", backend)
+		}
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("health_check path %q must start with /", path)
+		}
+	}
+	if hc.Interval < 0 || hc.Timeout < 0 || hc.HealthyThreshold < 0 || hc.UnhealthyThreshold < 0 {
+		return fmt.Errorf("health_check settings must not be negative")
+	}
+	if hc.Interval > 0 && hc.Interval < Duration(time.Second) {
+		return fmt.Errorf("health_check interval must be at least 1s")
+	}
+	return nil
+}
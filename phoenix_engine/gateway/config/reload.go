@@ -0,0 +1,95 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"reflect"
+	"time"
+)
+
+// ReloadFile re-reads the config file and applies it. If the file does not
+// parse or validate, the running configuration is left untouched.
+func (c *Config) ReloadFile() (*FileConfig, error) {
+	c.Mu.RLock()
+	path := c.FilePath
+	c.Mu.RUnlock()
+
+	fc, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c.ApplyFile(path, fc)
+
+	if err := c.Persist(); err != nil {
+		slog.Error("failed to persist routing state after reload", "error", err)
+	}
+	return fc, nil
+}
+
+// WatchFile reloads the config file whenever a signal arrives on reload
+// (SIGHUP) or the file's modification time changes. running is the config
+// the process started with; settings that cannot change without a restart
+// are compared against it. WatchFile blocks, so run it in a goroutine.
+func (c *Config) WatchFile(running *FileConfig, interval time.Duration, reload <-chan os.Signal) {
+	c.Mu.RLock()
+	path := c.FilePath
+	c.Mu.RUnlock()
+
+	lastMod := modTime(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-reload:
+			slog.Info("received SIGHUP, reloading config", "path", path)
+		case <-ticker.C:
+			mod := modTime(path)
+			if mod.Equal(lastMod) {
+				continue
+			}
+			slog.Info("config file changed, reloading", "path", path)
+		}
+		lastMod = modTime(path)
+
+		fc, err := c.ReloadFile()
+		if err != nil {
+			slog.Error("config reload rejected, keeping current config", "path", path, "error", err)
+			continue
+		}
+
+		if fc.Listen != running.Listen {
+			slog.Warn("restart the gateway to apply the change", "setting", "listen", "value", fc.Listen)
+		}
+		if !reflect.DeepEqual(fc.Events, running.Events) {
+			slog.Warn("restart the gateway to apply the change", "setting", "events")
+		}
+		if fc.StateStore != running.StateStore {
+			slog.Warn("restart the gateway to apply the change", "setting", "state_store")
+		}
+		if !reflect.DeepEqual(fc.AdminAuth, running.AdminAuth) || fc.TLS != running.TLS {
+			slog.Warn("restart the gateway to apply the change", "setting", "admin_auth/tls")
+		}
+		if fc.AuditLog != running.AuditLog {
+			slog.Warn("restart the gateway to apply the change", "setting", "audit_log")
+		}
+		if !reflect.DeepEqual(fc.Tracing, running.Tracing) {
+			slog.Warn("restart the gateway to apply the change", "setting", "tracing")
+		}
+		if !reflect.DeepEqual(fc.Logging, running.Logging) {
+			slog.Warn("restart the gateway to apply the change", "setting", "logging")
+		}
+		if fc.Shutdown != running.Shutdown {
+			slog.Warn("restart the gateway to apply the change", "setting", "shutdown")
+		}
+		slog.Info("config reloaded", "path", path, "migrations", len(fc.Migrations))
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
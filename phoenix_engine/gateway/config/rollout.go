@@ -0,0 +1,374 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rollout states.
+const (
+	RolloutRunning   = "running"
+	RolloutPaused    = "paused"
+	RolloutCompleted = "completed"
+	RolloutAborted   = "aborted"
+)
+
+// ErrRolloutActive is returned when a plan already drives the same weight.
+var ErrRolloutActive = errors.New("another rollout is active")
+
+// maxFinishedRollouts bounds how many completed or aborted plans are kept.
+const maxFinishedRollouts = 50
+
+// RolloutStep is one weight in a rollout plan and how long to hold it.
+type RolloutStep struct {
+	Weight float64  `json:"weight"`
+	Dwell  Duration `json:"dwell,omitempty"` // Zero uses the plan's MinDwell
+}
+
+// Rollout is a progressive rollout plan the gateway executes itself. It
+// ramps a service weight, or one route's weight when Path is set, through
+// Steps, holding each for at least its dwell time.
+type Rollout struct {
+	ID       string        `json:"id"`
+	Service  string        `json:"service"`
+	Method   string        `json:"method,omitempty"`
+	Path     string        `json:"path,omitempty"`
+	Steps    []RolloutStep `json:"steps"`
+	MinDwell Duration      `json:"min_dwell"`
+
+	State         string    `json:"state"`
+	CurrentStep   int       `json:"current_step"` // Index of the step currently applied
+	StepStartedAt time.Time `json:"step_started_at"`
+	PausedElapsed Duration  `json:"paused_elapsed,omitempty"` // Time already spent in the step when paused
+	StartWeight   float64   `json:"start_weight"`             // Weight before the plan, used by abort with rollback
+	StateReason   string    `json:"state_reason,omitempty"`
+	CreatedBy     string    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// RolloutChange is a weight change made while executing a rollout.
+type RolloutChange struct {
+	Rollout   Rollout
+	OldWeight float64
+	NewWeight float64
+}
+
+func (ro *Rollout) Validate() error {
+	if ro.Service == "" {
+		return fmt.Errorf("service must be set")
+	}
+	if ro.Path == "" && ro.Method != "" {
+		return fmt.Errorf("method needs a path")
+	}
+	if len(ro.Steps) == 0 {
+		return fmt.Errorf("steps must list at least one weight")
+	}
+	if ro.MinDwell < 0 {
+		return fmt.Errorf("min_dwell must not be negative")
+	}
+	for i, step := range ro.Steps {
+		if step.Weight < 0 || step.Weight > 1 {
+			return fmt.Errorf("steps[%d]: weight %.2f must be between 0 and 1", i, step.Weight)
+		}
+		if step.Dwell < 0 {
+			return fmt.Errorf("steps[%d]: dwell must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// Route is the key of the route the plan ramps, or "" for the service weight.
+func (ro *Rollout) Route() string {
+	if ro.Path == "" {
+		return ""
+	}
+	rule := RouteRule{Method: ro.Method, Path: ro.Path}
+	return rule.Key()
+}
+
+// Active reports whether the plan still drives its weight.
+func (ro *Rollout) Active() bool {
+	return ro.State == RolloutRunning || ro.State == RolloutPaused
+}
+
+func (ro *Rollout) dwell(step int) time.Duration {
+	if d := ro.Steps[step].Dwell; d > 0 {
+		return time.Duration(d)
+	}
+	return time.Duration(ro.MinDwell)
+}
+
+// NextStepAt is when the next step becomes due, or zero if none is pending.
+func (ro *Rollout) NextStepAt() time.Time {
+	if ro.State != RolloutRunning || ro.CurrentStep+1 >= len(ro.Steps) {
+		return time.Time{}
+	}
+	return ro.StepStartedAt.Add(ro.dwell(ro.CurrentStep))
+}
+
+func (ro *Rollout) clone() Rollout {
+	cp := *ro
+	cp.Steps = append([]RolloutStep(nil), ro.Steps...)
+	return cp
+}
+
+// StartRollout validates the plan, applies its first step and starts it.
+// Only one active plan may drive a given service or route.
+func (c *Config) StartRollout(ro Rollout, now time.Time) (RolloutChange, error) {
+	ro.Method = strings.ToUpper(ro.Method)
+	if err := ro.Validate(); err != nil {
+		return RolloutChange{}, err
+	}
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if _, ok := c.Migrations[ro.Service]; !ok {
+		return RolloutChange{}, fmt.Errorf("unknown service %q", ro.Service)
+	}
+	if err := c.checkNoRolloutLocked(ro.Service, ro.Route()); err != nil {
+		return RolloutChange{}, err
+	}
+
+	ro.State = RolloutRunning
+	ro.CurrentStep = 0
+	ro.StepStartedAt = now
+	ro.CreatedAt = now
+	ro.UpdatedAt = now
+
+	old, err := c.setRolloutWeightLocked(&ro, ro.Steps[0].Weight)
+	if err != nil {
+		return RolloutChange{}, err
+	}
+	ro.StartWeight = old
+	if len(ro.Steps) == 1 {
+		ro.State = RolloutCompleted
+	}
+
+	if c.Rollouts == nil {
+		c.Rollouts = map[string]*Rollout{}
+	}
+	c.Rollouts[ro.ID] = &ro
+	c.pruneRolloutsLocked()
+	return RolloutChange{Rollout: ro.clone(), OldWeight: old, NewWeight: ro.Steps[0].Weight}, nil
+}
+
+// AdvanceRollouts moves every running plan whose dwell time has passed to
+// its next step and returns the weight changes it made.
+func (c *Config) AdvanceRollouts(now time.Time) []RolloutChange {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	var changes []RolloutChange
+	for _, ro := range c.Rollouts {
+		if ro.State != RolloutRunning {
+			continue
+		}
+		if _, ok := c.Migrations[ro.Service]; !ok {
+			ro.State = RolloutAborted
+			ro.StateReason = "service was removed"
+			ro.UpdatedAt = now
+			continue
+		}
+
+		next := ro.NextStepAt()
+		if next.IsZero() || now.Before(next) {
+			continue
+		}
+
+		ro.CurrentStep++
+		ro.StepStartedAt = now
+		ro.UpdatedAt = now
+		weight := ro.Steps[ro.CurrentStep].Weight
+		old, err := c.setRolloutWeightLocked(ro, weight)
+		if err != nil {
+			ro.State = RolloutAborted
+			ro.StateReason = err.Error()
+			continue
+		}
+		if ro.CurrentStep == len(ro.Steps)-1 {
+			ro.State = RolloutCompleted
+		}
+		changes = append(changes, RolloutChange{Rollout: ro.clone(), OldWeight: old, NewWeight: weight})
+	}
+	return changes
+}
+
+// PauseRollout stops the dwell clock of a running plan.
+func (c *Config) PauseRollout(id string, now time.Time) (Rollout, error) {
+	return c.updateRollout(id, func(ro *Rollout) error {
+		if ro.State != RolloutRunning {
+			return fmt.Errorf("rollout is %s, not running", ro.State)
+		}
+		ro.State = RolloutPaused
+		ro.PausedElapsed = Duration(now.Sub(ro.StepStartedAt))
+		ro.UpdatedAt = now
+		return nil
+	})
+}
+
+// ResumeRollout restarts the dwell clock where PauseRollout stopped it.
+func (c *Config) ResumeRollout(id string, now time.Time) (Rollout, error) {
+	return c.updateRollout(id, func(ro *Rollout) error {
+		if ro.State != RolloutPaused {
+			return fmt.Errorf("rollout is %s, not paused", ro.State)
+		}
+		ro.State = RolloutRunning
+		ro.StepStartedAt = now.Add(-time.Duration(ro.PausedElapsed))
+		ro.PausedElapsed = 0
+		ro.UpdatedAt = now
+		return nil
+	})
+}
+
+// AbortRollout stops an active plan. The weight stays where it is unless
+// rollback is set, which restores the weight from before the plan started.
+func (c *Config) AbortRollout(id string, rollback bool, reason string, now time.Time) (Rollout, *RolloutChange, error) {
+	var change *RolloutChange
+	ro, err := c.updateRollout(id, func(ro *Rollout) error {
+		if !ro.Active() {
+			return fmt.Errorf("rollout is already %s", ro.State)
+		}
+		if rollback {
+			old, err := c.setRolloutWeightLocked(ro, ro.StartWeight)
+			if err != nil {
+				return err
+			}
+			change = &RolloutChange{OldWeight: old, NewWeight: ro.StartWeight}
+		}
+		ro.State = RolloutAborted
+		ro.StateReason = reason
+		ro.UpdatedAt = now
+		return nil
+	})
+	if change != nil {
+		change.Rollout = ro
+	}
+	return ro, change, err
+}
+
+// AbortRolloutsFor aborts every active plan driving the named service, for
+// example when something outside the plan forces the weight down.
+func (c *Config) AbortRolloutsFor(service, reason string, now time.Time) []Rollout {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	var aborted []Rollout
+	for _, ro := range c.Rollouts {
+		if ro.Active() && ro.Service == service {
+			ro.State = RolloutAborted
+			ro.StateReason = reason
+			ro.UpdatedAt = now
+			aborted = append(aborted, ro.clone())
+		}
+	}
+	return aborted
+}
+
+func (c *Config) updateRollout(id string, update func(ro *Rollout) error) (Rollout, error) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	ro, ok := c.Rollouts[id]
+	if !ok {
+		return Rollout{}, fmt.Errorf("unknown rollout %q", id)
+	}
+	if err := update(ro); err != nil {
+		return Rollout{}, err
+	}
+	c.pruneRolloutsLocked()
+	return ro.clone(), nil
+}
+
+// GetRollout returns a copy of the plan with id.
+func (c *Config) GetRollout(id string) (Rollout, bool) {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	ro, ok := c.Rollouts[id]
+	if !ok {
+		return Rollout{}, false
+	}
+	return ro.clone(), true
+}
+
+// ListRollouts returns copies of all plans, newest first.
+func (c *Config) ListRollouts() []Rollout {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	return c.listRolloutsLocked()
+}
+
+func (c *Config) listRolloutsLocked() []Rollout {
+	list := make([]Rollout, 0, len(c.Rollouts))
+	for _, ro := range c.Rollouts {
+		list = append(list, ro.clone())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// checkNoRolloutLocked returns ErrRolloutActive when an active plan drives
+// the weight of service, or of its route when route is a rule key, so a
+// manual change is not silently undone at the plan's next step. Callers
+// must hold c.Mu.
+func (c *Config) checkNoRolloutLocked(service, route string) error {
+	for _, ro := range c.Rollouts {
+		if ro.Active() && ro.Service == service && ro.Route() == route {
+			return fmt.Errorf("%w: %s is %s for %s %s; abort it first", ErrRolloutActive, ro.ID, ro.State, service, route)
+		}
+	}
+	return nil
+}
+
+// setRolloutWeightLocked sets the weight the plan drives and returns the
+// weight that applied before. Callers must hold c.Mu.
+func (c *Config) setRolloutWeightLocked(ro *Rollout, weight float64) (float64, error) {
+	m, ok := c.Migrations[ro.Service]
+	if !ok {
+		return 0, fmt.Errorf("unknown service %q", ro.Service)
+	}
+
+	if ro.Path == "" {
+		old := m.Weight
+		m.Weight = weight
+		return old, nil
+	}
+
+	old := m.Weight
+	if rule := m.findRoute(ro.Method, ro.Path); rule != nil {
+		if rule.Weight != nil {
+			old = *rule.Weight
+		}
+		rule.Weight = &weight
+		return old, nil
+	}
+
+	rule := RouteRule{Method: ro.Method, Path: ro.Path, Weight: &weight}
+	if err := rule.Validate(); err != nil {
+		return 0, err
+	}
+	m.Routes = append(m.Routes, rule)
+	return old, nil
+}
+
+// pruneRolloutsLocked drops the oldest finished plans beyond
+// maxFinishedRollouts. Callers must hold c.Mu.
+func (c *Config) pruneRolloutsLocked() {
+	var finished []*Rollout
+	for _, ro := range c.Rollouts {
+		if !ro.Active() {
+			finished = append(finished, ro)
+		}
+	}
+	if len(finished) <= maxFinishedRollouts {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].UpdatedAt.Before(finished[j].UpdatedAt) })
+	for _, ro := range finished[:len(finished)-maxFinishedRollouts] {
+		delete(c.Rollouts, ro.ID)
+	}
+}
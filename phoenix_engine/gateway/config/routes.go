@@ -0,0 +1,353 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RouteRule overrides the service-level weight and lock for requests whose
+// method and path match. Path is relative to the migration prefix; a trailing
+// "/*" matches the whole subtree. An empty Method matches any method.
+type RouteRule struct {
+	Method        string   `json:"method,omitempty" yaml:"method"`
+	Path          string   `json:"path" yaml:"path"`
+	Weight        *float64 `json:"weight,omitempty" yaml:"weight"`               // nil falls back to the service weight
+	ShadowSample  *float64 `json:"shadow_sample,omitempty" yaml:"shadow_sample"` // nil falls back to the service sampling
+	TrafficLocked bool     `json:"traffic_locked" yaml:"traffic_locked"`
+	StickyKey     string   `json:"sticky_key,omitempty" yaml:"sticky_key"`         // Empty inherits the service sticky key
+	Timeout       Duration `json:"timeout,omitempty" yaml:"timeout"`               // Deadline of calls to either backend; zero inherits the service timeouts
+	ShadowTimeout Duration `json:"shadow_timeout,omitempty" yaml:"shadow_timeout"` // Zero inherits the service shadow_timeout
+
+	// Fallback replaces the service's fallback policy; nil inherits it.
+	Fallback FallbackPolicy `json:"fallback,omitempty" yaml:"fallback"`
+	// FallbackWrites lets a write that reached only the primary be re-sent
+	// to the other backend after a connection error or 5xx. Only set it
+	// when the backends de-duplicate the write; timeouts never fall back.
+	FallbackWrites bool `json:"fallback_writes,omitempty" yaml:"fallback_writes"`
+
+	// StateKeys name the business keys published in db-state-updates after
+	// a shadowed write, each read from a dotted path in the request body,
+	// e.g. {"account_number": "from.account"}.
+	StateKeys map[string]string `json:"state_keys,omitempty" yaml:"state_keys"`
+}
+
+// Key identifies a rule within its migration, e.g. "POST /transfer-funds".
+func (rr *RouteRule) Key() string {
+	if rr.Method == "" {
+		return "* " + rr.Path
+	}
+	return rr.Method + " " + rr.Path
+}
+
+func (rr *RouteRule) Validate() error {
+	if !strings.HasPrefix(rr.Path, "/") {
+		return fmt.Errorf("route path %q must start with /", rr.Path)
+	}
+	if strings.Contains(strings.TrimSuffix(rr.Path, "/*"), "*") {
+		return fmt.Errorf("route path %q may only use * as a trailing /* wildcard", rr.Path)
+	}
+	if rr.Method != strings.ToUpper(rr.Method) {
+		return fmt.Errorf("route method %q must be upper case", rr.Method)
+	}
+	if rr.Weight != nil && (*rr.Weight < 0 || *rr.Weight > 1) {
+		return fmt.Errorf("route %s weight %.2f must be between 0 and 1", rr.Key(), *rr.Weight)
+	}
+	if err := validateShadowSample(rr.ShadowSample); err != nil {
+		return fmt.Errorf("route %s %s", rr.Key(), err)
+	}
+	if rr.Timeout < 0 || rr.ShadowTimeout < 0 {
+		return fmt.Errorf("route %s timeouts must not be negative", rr.Key())
+	}
+	if rr.StickyKey != "" {
+		if _, _, err := ParseStickyKey(rr.StickyKey); err != nil {
+			return fmt.Errorf("route %s: %s", rr.Key(), err)
+		}
+	}
+	for name, path := range rr.StateKeys {
+		if name == "" || path == "" {
+			return fmt.Errorf("route %s: state_keys entries need a name and a body path", rr.Key())
+		}
+	}
+	if err := rr.Fallback.Validate(); err != nil {
+		return fmt.Errorf("route %s: %s", rr.Key(), err)
+	}
+	return nil
+}
+
+// specificity ranks how closely the rule matches method and path, or returns
+// -1 when it does not match. Longer literal paths win, then exact paths over
+// wildcards, then a specific method over any method.
+func (rr *RouteRule) specificity(method, path string) int {
+	if rr.Method != "" && rr.Method != method {
+		return -1
+	}
+
+	score := 0
+	if literal := strings.TrimSuffix(rr.Path, "/*"); literal != rr.Path {
+		if literal != "" && path != literal && !strings.HasPrefix(path, literal+"/") {
+			return -1
+		}
+		score = len(literal) * 4
+	} else {
+		if path != rr.Path {
+			return -1
+		}
+		score = len(rr.Path)*4 + 2
+	}
+
+	if rr.Method != "" {
+		score++
+	}
+	return score
+}
+
+// RouteTarget is where a single request should go, resolved from the
+// registry when the request arrives.
+type RouteTarget struct {
+	Service   string
+	Route     string // Matched rule key; empty when the service default applies
+	Path      string // Request path relative to the migration prefix
+	LegacyURL string
+	ModernURL string
+	Weight    float64
+	Locked    bool
+
+	// ShadowSample is the share of requests mirrored to the backend that
+	// is not primary, independent of Weight.
+	ShadowSample float64
+
+	StickyKey string
+	StateKeys map[string]string // Business keys for db-state-updates; nil when the rule has none
+
+	// Deadlines of the calls the client waits for, per backend.
+	LegacyTimeout time.Duration
+	ModernTimeout time.Duration
+
+	// ShadowTimeout bounds the shadow call, which runs after the client
+	// already has its response; zero uses the shadowed backend's timeout.
+	ShadowTimeout time.Duration
+
+	CircuitBreaker *CircuitBreaker // nil when the service has no breaker
+	BreakerOpen    bool            // The breaker is open or half-open; modern only gets probes
+	Probe          bool            // Admitted as a half-open probe; only its modern call is counted
+	Compare        CompareRules
+	Fallback       FallbackPolicy
+	FallbackWrites bool     // Writes may be re-sent to the other backend; see RouteRule
+	Upstream       Upstream // Connection settings for both backends
+}
+
+// TimeoutFor is the deadline of a call to backend that the client waits for.
+func (t RouteTarget) TimeoutFor(backend string) time.Duration {
+	if backend == "modern" {
+		return t.ModernTimeout
+	}
+	return t.LegacyTimeout
+}
+
+// ShadowTimeoutFor is the deadline of the background shadow call to backend.
+func (t RouteTarget) ShadowTimeoutFor(backend string) time.Duration {
+	if t.ShadowTimeout > 0 {
+		return t.ShadowTimeout
+	}
+	return t.TimeoutFor(backend)
+}
+
+// Resolve maps an inbound request to its migration and the most specific
+// route rule, falling back to the service-level weight and lock.
+func (c *Config) Resolve(method, path string) (RouteTarget, bool) {
+	m, rest, ok := c.MatchMigration(path)
+	if !ok {
+		return RouteTarget{}, false
+	}
+	return c.resolve(m, method, rest), true
+}
+
+// ResolveIn is Resolve for a path already relative to the named migration.
+func (c *Config) ResolveIn(name, method, path string) (RouteTarget, bool) {
+	m, ok := c.GetMigration(name)
+	if !ok {
+		return RouteTarget{}, false
+	}
+	return c.resolve(m, method, path), true
+}
+
+func (c *Config) resolve(m Migration, method, path string) RouteTarget {
+	c.Mu.RLock()
+	timeout := time.Duration(m.Timeout)
+	if timeout == 0 {
+		timeout = c.UpstreamTimeout
+	}
+	upstream := c.Upstream
+	c.Mu.RUnlock()
+	legacyTimeout, modernTimeout := timeout, timeout
+	if m.LegacyTimeout > 0 {
+		legacyTimeout = time.Duration(m.LegacyTimeout)
+	}
+	if m.ModernTimeout > 0 {
+		modernTimeout = time.Duration(m.ModernTimeout)
+	}
+	if m.Upstream != nil {
+		upstream = m.Upstream.Inherit(upstream)
+	}
+
+	target := RouteTarget{
+		Service:   m.Name,
+		Path:      path,
+		LegacyURL: m.LegacyURL,
+		ModernURL: m.ModernURL,
+		Weight:    m.Weight,
+		Locked:    m.TrafficLocked || c.IsTrafficLocked(),
+		StickyKey: m.StickyKey,
+
+		LegacyTimeout:  legacyTimeout,
+		ModernTimeout:  modernTimeout,
+		ShadowTimeout:  time.Duration(m.ShadowTimeout),
+		CircuitBreaker: m.CircuitBreaker,
+		Compare:        DefaultCompareRules(),
+		Fallback:       m.Fallback,
+		Upstream:       upstream,
+	}
+	if m.Compare != nil {
+		target.Compare = *m.Compare
+	}
+
+	rule := m.matchRoute(method, path)
+	if rule != nil {
+		target.Route = rule.Key()
+		if rule.Weight != nil {
+			target.Weight = *rule.Weight
+		}
+		target.Locked = target.Locked || rule.TrafficLocked
+		if rule.StickyKey != "" {
+			target.StickyKey = rule.StickyKey
+		}
+		target.StateKeys = rule.StateKeys
+		if rule.Fallback != nil {
+			target.Fallback = rule.Fallback
+		}
+		target.FallbackWrites = rule.FallbackWrites
+		if rule.Timeout > 0 {
+			target.LegacyTimeout = time.Duration(rule.Timeout)
+			target.ModernTimeout = time.Duration(rule.Timeout)
+		}
+		if rule.ShadowTimeout > 0 {
+			target.ShadowTimeout = time.Duration(rule.ShadowTimeout)
+		}
+	}
+	target.ShadowSample = m.EffectiveShadowSample(rule)
+
+	return target
+}
+
+func (m *Migration) matchRoute(method, path string) *RouteRule {
+	var best *RouteRule
+	bestScore := -1
+	for i := range m.Routes {
+		if score := m.Routes[i].specificity(method, path); score > bestScore {
+			best, bestScore = &m.Routes[i], score
+		}
+	}
+	return best
+}
+
+// Route returns a copy of the rule for exactly method and path.
+func (m *Migration) Route(method, path string) (RouteRule, bool) {
+	rule := m.findRoute(strings.ToUpper(method), path)
+	if rule == nil {
+		return RouteRule{}, false
+	}
+	return rule.clone(), true
+}
+
+func (m *Migration) findRoute(method, path string) *RouteRule {
+	for i := range m.Routes {
+		if m.Routes[i].Method == method && m.Routes[i].Path == path {
+			return &m.Routes[i]
+		}
+	}
+	return nil
+}
+
+// SetRouteWeight creates or updates the rule for method and path on the named
+// migration. It returns the rule's previous weight, nil if the rule did not
+// exist or inherited the service weight. While a rollout plan drives the
+// route's weight it returns ErrRolloutActive instead.
+func (c *Config) SetRouteWeight(name, method, path string, weight float64) (*float64, error) {
+	old, err := c.updateRoute(name, method, path, func(rr *RouteRule) error {
+		if err := c.checkNoRolloutLocked(name, rr.Key()); err != nil {
+			return err
+		}
+		rr.Weight = &weight
+		return nil
+	})
+	return old.Weight, err
+}
+
+// SetRouteLocked creates or updates the rule for method and path on the named
+// migration and returns its previous lock. A new rule created this way
+// inherits the service weight.
+func (c *Config) SetRouteLocked(name, method, path string, locked bool) (bool, error) {
+	old, err := c.updateRoute(name, method, path, func(rr *RouteRule) error {
+		rr.TrafficLocked = locked
+		return nil
+	})
+	return old.TrafficLocked, err
+}
+
+// updateRoute applies update to the rule for method and path, creating it if
+// needed, and returns the rule as it was before.
+func (c *Config) updateRoute(name, method, path string, update func(rr *RouteRule) error) (RouteRule, error) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	m, ok := c.Migrations[name]
+	if !ok {
+		return RouteRule{}, fmt.Errorf("unknown service %q", name)
+	}
+
+	rule := RouteRule{Method: strings.ToUpper(method), Path: path}
+	old := rule
+	if existing := m.findRoute(rule.Method, rule.Path); existing != nil {
+		old = existing.clone()
+		rule = existing.clone()
+	}
+	if err := update(&rule); err != nil {
+		return RouteRule{}, err
+	}
+	if err := rule.Validate(); err != nil {
+		return RouteRule{}, err
+	}
+
+	if existing := m.findRoute(rule.Method, rule.Path); existing != nil {
+		*existing = rule
+	} else {
+		m.Routes = append(m.Routes, rule)
+	}
+	return old, nil
+}
+
+func (rr *RouteRule) clone() RouteRule {
+	cp := *rr
+	cp.Weight = copyFloat(rr.Weight)
+	cp.ShadowSample = copyFloat(rr.ShadowSample)
+	cp.Fallback = rr.Fallback.clone()
+	if rr.StateKeys != nil {
+		cp.StateKeys = make(map[string]string, len(rr.StateKeys))
+		for name, path := range rr.StateKeys {
+			cp.StateKeys[name] = path
+		}
+	}
+	return cp
+}
+
+func cloneRoutes(routes []RouteRule) []RouteRule {
+	if routes == nil {
+		return nil
+	}
+	cp := make([]RouteRule, len(routes))
+	for i := range routes {
+		cp[i] = routes[i].clone()
+	}
+	return cp
+}
@@ -0,0 +1,73 @@
+package config
+
+import "fmt"
+
+// defaultShadowSample is the sampling used when neither the route nor the
+// service sets one: every request is mirrored while traffic is split, and
+// none once a single backend takes it all.
+func defaultShadowSample(weight float64) float64 {
+	if weight > 0 && weight < 1 {
+		return 1
+	}
+	return 0
+}
+
+// EffectiveShadowSample is the sampling that applies to requests matching
+// rule, or to the service default when rule is nil.
+func (m *Migration) EffectiveShadowSample(rule *RouteRule) float64 {
+	weight, sample := m.Weight, m.ShadowSample
+	if rule != nil {
+		if rule.Weight != nil {
+			weight = *rule.Weight
+		}
+		if rule.ShadowSample != nil {
+			sample = rule.ShadowSample
+		}
+	}
+	if sample != nil {
+		return *sample
+	}
+	return defaultShadowSample(weight)
+}
+
+func validateShadowSample(sample *float64) error {
+	if sample != nil && (*sample < 0 || *sample > 1) {
+		return fmt.Errorf("shadow_sample %.2f must be between 0 and 1", *sample)
+	}
+	return nil
+}
+
+// SetShadowSample sets the share of the service's requests mirrored to the
+// other backend and returns the previous value. nil restores the default.
+func (c *Config) SetShadowSample(name string, sample *float64) (*float64, error) {
+	if err := validateShadowSample(sample); err != nil {
+		return nil, err
+	}
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	m, ok := c.Migrations[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown service %q", name)
+	}
+	old := m.ShadowSample
+	m.ShadowSample = copyFloat(sample)
+	return old, nil
+}
+
+// SetRouteShadowSample is SetShadowSample for the rule for method and path,
+// creating the rule if needed. nil makes the route inherit the service value.
+func (c *Config) SetRouteShadowSample(name, method, path string, sample *float64) (*float64, error) {
+	old, err := c.updateRoute(name, method, path, func(rr *RouteRule) error {
+		rr.ShadowSample = copyFloat(sample)
+		return nil
+	})
+	return old.ShadowSample, err
+}
+
+func copyFloat(f *float64) *float64 {
+	if f == nil {
+		return nil
+	}
+	v := *f
+	return &v
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Snapshot is the routing state that survives a gateway restart.
+type Snapshot struct {
+	TrafficLocked bool        `json:"traffic_locked"`
+	Migrations    []Migration `json:"migrations"`
+	Rollouts      []Rollout   `json:"rollouts,omitempty"`
+	// File is the config file as last applied, when one is in use.
+	File    *FileState `json:"file,omitempty"`
+	SavedAt time.Time  `json:"saved_at"`
+}
+
+// StateStore persists routing state. Implementations live in the store
+// package.
+type StateStore interface {
+	// Load returns the last saved snapshot, or nil if nothing was saved yet.
+	Load() (*Snapshot, error)
+	Save(snapshot *Snapshot) error
+	// String describes the store for the admin API, e.g. "file:/data/state.json".
+	String() string
+}
+
+// Snapshot captures the current routing state.
+func (c *Config) Snapshot() *Snapshot {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	return c.snapshotLocked()
+}
+
+// snapshotLocked is Snapshot for callers that already hold c.Mu.
+func (c *Config) snapshotLocked() *Snapshot {
+	return &Snapshot{
+		TrafficLocked: c.TrafficLocked,
+		Migrations:    c.listMigrationsLocked(),
+		Rollouts:      c.listRolloutsLocked(),
+		File:          c.file.clone(),
+		SavedAt:       time.Now().UTC(),
+	}
+}
+
+// Restore replaces the routing state with snapshot. Every migration is
+// validated before anything is changed.
+func (c *Config) Restore(snapshot *Snapshot) error {
+	migrations := make(map[string]*Migration, len(snapshot.Migrations))
+	prefixes := make(map[string]string, len(snapshot.Migrations))
+	for i := range snapshot.Migrations {
+		m := snapshot.Migrations[i].clone()
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("migration %q: %w", m.Name, err)
+		}
+		if other, ok := prefixes[m.PathPrefix]; ok {
+			return fmt.Errorf("path_prefix %q is used by both %q and %q", m.PathPrefix, other, m.Name)
+		}
+		prefixes[m.PathPrefix] = m.Name
+		migrations[m.Name] = &m
+	}
+
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	c.Migrations = migrations
+	c.TrafficLocked = snapshot.TrafficLocked
+	c.restoreRollouts(snapshot.Rollouts)
+	return nil
+}
+
+// restoreRollouts replaces the rollout plans, so a restarted gateway picks
+// up running plans at the step they had reached. Callers must hold c.Mu.
+func (c *Config) restoreRollouts(rollouts []Rollout) {
+	c.Rollouts = make(map[string]*Rollout, len(rollouts))
+	for i := range rollouts {
+		ro := rollouts[i].clone()
+		c.Rollouts[ro.ID] = &ro
+	}
+}
+
+// UseStore attaches the store that Persist writes to and loads the state
+// saved in it, if any.
+func (c *Config) UseStore(store StateStore) error {
+	c.persistMu.Lock()
+	defer c.persistMu.Unlock()
+
+	c.store = store
+	c.stateSource = "defaults"
+
+	snapshot, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("loading state from %s: %w", store, err)
+	}
+	if snapshot == nil {
+		return nil
+	}
+
+	c.Mu.RLock()
+	fromFile := c.FilePath != ""
+	c.Mu.RUnlock()
+
+	if fromFile {
+		// The config file owns the migration list; only restore live
+		// state, and only where the file was not edited while stopped
+		c.Mu.Lock()
+		c.mergeFileLocked(snapshot.File, snapshot, c.file)
+		c.Mu.Unlock()
+	} else if err := c.Restore(snapshot); err != nil {
+		return fmt.Errorf("restoring state from %s: %w", store, err)
+	}
+	c.stateSource = store.String()
+	return nil
+}
+
+// Persist writes the current routing state to the attached store. It is a
+// no-op when no store is configured.
+func (c *Config) Persist() error {
+	// Snapshotting under persistMu means the last writer always saves the
+	// newest state, even when two admin calls race.
+	c.persistMu.Lock()
+	defer c.persistMu.Unlock()
+
+	if c.store == nil {
+		return nil
+	}
+	return c.store.Save(c.Snapshot())
+}
+
+// StateInfo reports the configured store and where the running state was
+// loaded from ("defaults" when nothing was restored).
+func (c *Config) StateInfo() (store, source string) {
+	c.persistMu.Lock()
+	defer c.persistMu.Unlock()
+
+	store, source = "memory", c.stateSource
+	if c.store != nil {
+		store = c.store.String()
+	}
+	if source == "" {
+		source = "defaults"
+	}
+	return store, source
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sticky key sources. A sticky key is written as "<source>:<name>", for
+// example "body:account_number", "header:X-Account-Id" or "cookie:PHPSESSID".
+const (
+	StickyFromBody   = "body"
+	StickyFromHeader = "header"
+	StickyFromCookie = "cookie"
+)
+
+// ParseStickyKey splits a sticky key spec into its source and name.
+func ParseStickyKey(spec string) (source, name string, err error) {
+	source, name, found := strings.Cut(spec, ":")
+	if !found || name == "" {
+		return "", "", fmt.Errorf("sticky_key %q must look like <source>:<name>", spec)
+	}
+	switch source {
+	case StickyFromBody, StickyFromHeader, StickyFromCookie:
+		return source, name, nil
+	}
+	return "", "", fmt.Errorf("sticky_key %q: source must be body, header or cookie", spec)
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Upstream tunes the pooled connections to the backends. The gateway-wide
+// settings apply to every migration; a migration's own upstream section
+// overrides the fields it sets. The overall deadline of a call is the
+// migration's timeout, not part of these settings.
+type Upstream struct {
+	DialTimeout           Duration `json:"dial_timeout,omitempty" yaml:"dial_timeout"`                       // Default 5s
+	KeepAlive             Duration `json:"keep_alive,omitempty" yaml:"keep_alive"`                           // TCP keep-alive probes, default 30s
+	TLSHandshakeTimeout   Duration `json:"tls_handshake_timeout,omitempty" yaml:"tls_handshake_timeout"`     // Default 5s
+	ResponseHeaderTimeout Duration `json:"response_header_timeout,omitempty" yaml:"response_header_timeout"` // Zero waits up to the overall timeout
+	IdleConnTimeout       Duration `json:"idle_conn_timeout,omitempty" yaml:"idle_conn_timeout"`             // Default 90s
+	MaxIdleConns          int      `json:"max_idle_conns,omitempty" yaml:"max_idle_conns"`                   // Across all backends, default 512
+	MaxIdleConnsPerHost   int      `json:"max_idle_conns_per_host,omitempty" yaml:"max_idle_conns_per_host"` // Default 128
+	MaxConnsPerHost       int      `json:"max_conns_per_host,omitempty" yaml:"max_conns_per_host"`           // Zero is unlimited
+	CAFile                string   `json:"ca_file,omitempty" yaml:"ca_file"`                                 // Trusted for https backends in addition to the system roots
+}
+
+// WithDefaults returns u with zero settings replaced by their defaults.
+func (u Upstream) WithDefaults() Upstream {
+	if u.DialTimeout == 0 {
+		u.DialTimeout = Duration(5 * time.Second)
+	}
+	if u.KeepAlive == 0 {
+		u.KeepAlive = Duration(30 * time.Second)
+	}
+	if u.TLSHandshakeTimeout == 0 {
+		u.TLSHandshakeTimeout = Duration(5 * time.Second)
+	}
+	if u.IdleConnTimeout == 0 {
+		u.IdleConnTimeout = Duration(90 * time.Second)
+	}
+	if u.MaxIdleConns == 0 {
+		u.MaxIdleConns = 512
+	}
+	if u.MaxIdleConnsPerHost == 0 {
+		u.MaxIdleConnsPerHost = 128
+	}
+	return u
+}
+
+// Inherit returns u with zero settings taken from base.
+func (u Upstream) Inherit(base Upstream) Upstream {
+	if u.DialTimeout == 0 {
+		u.DialTimeout = base.DialTimeout
+	}
+	if u.KeepAlive == 0 {
+		u.KeepAlive = base.KeepAlive
+	}
+	if u.TLSHandshakeTimeout == 0 {
+		u.TLSHandshakeTimeout = base.TLSHandshakeTimeout
+	}
+	if u.ResponseHeaderTimeout == 0 {
+		u.ResponseHeaderTimeout = base.ResponseHeaderTimeout
+	}
+	if u.IdleConnTimeout == 0 {
+		u.IdleConnTimeout = base.IdleConnTimeout
+	}
+	if u.MaxIdleConns == 0 {
+		u.MaxIdleConns = base.MaxIdleConns
+	}
+	if u.MaxIdleConnsPerHost == 0 {
+		u.MaxIdleConnsPerHost = base.MaxIdleConnsPerHost
+	}
+	if u.MaxConnsPerHost == 0 {
+		u.MaxConnsPerHost = base.MaxConnsPerHost
+	}
+	if u.CAFile == "" {
+		u.CAFile = base.CAFile
+	}
+	return u
+}
+
+func (u *Upstream) Validate() error {
+	if u.DialTimeout < 0 || u.KeepAlive < 0 || u.TLSHandshakeTimeout < 0 || u.ResponseHeaderTimeout < 0 || u.IdleConnTimeout < 0 {
+		return fmt.Errorf("upstream timeouts must not be negative")
+	}
+	if u.MaxIdleConns < 0 || u.MaxIdleConnsPerHost < 0 || u.MaxConnsPerHost < 0 {
+		return fmt.Errorf("upstream connection limits must not be negative")
+	}
+	if u.CAFile != "" {
+		if _, err := LoadCertPool(u.CAFile); err != nil {
+			return fmt.Errorf("upstream ca_file: %s", err)
+		}
+	}
+	return nil
+}
+
+// LoadCertPool returns the system roots plus the PEM certificates in file.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,112 @@
+package events
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"gateway/config"
+	"gateway/services"
+)
+
+// Sinks are the sinks opened from the config file. All receives every
+// event; Kafka and Memory are kept for the admin API and are nil unless
+// configured.
+type Sinks struct {
+	All    Fanout
+	Kafka  *Kafka
+	Memory *Memory
+
+	counted []*countedSink
+}
+
+// SinkCounts are how many events one sink took and refused.
+type SinkCounts struct {
+	Name   string `json:"name"`
+	Sent   int64  `json:"sent"`
+	Failed int64  `json:"failed"`
+}
+
+// countedSink counts the outcome of every Send to the sink it wraps.
+type countedSink struct {
+	Sink
+	name   string
+	sent   atomic.Int64
+	failed atomic.Int64
+}
+
+func (c *countedSink) Send(topic string, value []byte) error {
+	err := c.Sink.Send(topic, value)
+	if err != nil {
+		c.failed.Add(1)
+	} else {
+		c.sent.Add(1)
+	}
+	return err
+}
+
+func (s *Sinks) add(name string, sink Sink) {
+	counted := &countedSink{Sink: sink, name: name}
+	s.counted = append(s.counted, counted)
+	s.All = append(s.All, counted)
+}
+
+// Counts reports the events each sink took and refused since startup.
+func (s *Sinks) Counts() []SinkCounts {
+	counts := make([]SinkCounts, 0, len(s.counted))
+	for _, c := range s.counted {
+		counts = append(counts, SinkCounts{Name: c.name, Sent: c.sent.Load(), Failed: c.failed.Load()})
+	}
+	return counts
+}
+
+// FromConfig opens every sink configured in cfg. A file or outbox that
+// cannot be opened is an error; a broker that is down is not, events wait in
+// the outbox until it is back.
+func FromConfig(cfg config.EventsFile) (*Sinks, error) {
+	sinks := &Sinks{}
+
+	if cfg.Kafka.BootstrapServers != "" {
+		if services.KafkaAvailable {
+			kafka, err := NewKafka(cfg.Kafka)
+			if err != nil {
+				return nil, err
+			}
+			sinks.Kafka = kafka
+			sinks.add("kafka", kafka)
+			log.Printf("Kafka sink initialized (%s)", cfg.Kafka.BootstrapServers)
+		} else {
+			log.Printf("WARNING: events.kafka is configured but this binary was built with -tags nokafka")
+		}
+	}
+
+	if cfg.File.Path != "" {
+		file, err := OpenFile(cfg.File.Path, int64(cfg.File.MaxSizeMB)<<20, cfg.File.MaxBackups)
+		if err != nil {
+			sinks.All.Close()
+			return nil, err
+		}
+		sinks.add("file", file)
+		log.Printf("Event file sink: %s", cfg.File.Path)
+	}
+
+	if cfg.Stdout {
+		sinks.add("stdout", Stdout())
+		log.Println("Event stdout sink enabled")
+	}
+
+	if cfg.Webhook.URL != "" {
+		sinks.add("webhook", NewWebhook(cfg.Webhook.URL, time.Duration(cfg.Webhook.Timeout), cfg.Webhook.Headers))
+		log.Printf("Event webhook sink: %s", cfg.Webhook.URL)
+	}
+
+	if cfg.Memory > 0 {
+		sinks.Memory = NewMemory(cfg.Memory)
+		sinks.add("memory", sinks.Memory)
+	}
+
+	if len(sinks.All) == 0 {
+		log.Println("WARNING: no event sinks configured; shadow and audit events are dropped")
+	}
+	return sinks, nil
+}
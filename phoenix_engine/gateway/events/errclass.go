@@ -0,0 +1,50 @@
+package events
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Error classes reported in BackendResult.ErrorClass.
+const (
+	ErrorTimeout           = "timeout"
+	ErrorCanceled          = "canceled"
+	ErrorConnectionRefused = "connection_refused"
+	ErrorConnectionReset   = "connection_reset"
+	ErrorDNS               = "dns"
+	ErrorTLS               = "tls"
+	ErrorTransport         = "transport" // Any other failure before a response arrived
+	ErrorHTTP5xx           = "http_5xx"
+)
+
+// ClassifyError maps an upstream call error to one of the error classes.
+func ClassifyError(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var certErr x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	case errors.As(err, &dnsErr):
+		return ErrorDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrorConnectionReset
+	case errors.As(err, &certErr), errors.As(err, &hostErr), errors.As(err, &invalidErr):
+		return ErrorTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	}
+	return ErrorTransport
+}
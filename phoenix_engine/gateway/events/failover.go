@@ -0,0 +1,47 @@
+package events
+
+import "time"
+
+// FailoverSchemaVersion is the version of FailoverEvent.
+const FailoverSchemaVersion = 1
+
+// FailoverEventType is the event_type of every FailoverEvent.
+const FailoverEventType = "failover"
+
+// FailoverEvent is published to the failover topic for every request whose
+// chosen primary was failing its health checks and that was served by the
+// other backend instead. The backend it failed over from did not see the
+// request, so consumers know not to expect its write.
+type FailoverEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	EventType     string    `json:"event_type"`
+	TransactionID string    `json:"transaction_id"`
+	Timestamp     time.Time `json:"timestamp"`
+
+	ServiceType string `json:"service_type"`
+	Route       string `json:"route"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+
+	From   string `json:"from"` // Backend the weight chose: "legacy" or "modern"
+	To     string `json:"to"`   // Backend that served the request
+	Reason string `json:"reason"`
+}
+
+// NewFailoverEvent records that the request behind shadow went to the
+// backend named to instead of from.
+func NewFailoverEvent(shadow *ShadowEvent, from, to, reason string) *FailoverEvent {
+	return &FailoverEvent{
+		SchemaVersion: FailoverSchemaVersion,
+		EventType:     FailoverEventType,
+		TransactionID: shadow.TransactionID,
+		Timestamp:     time.Now().UTC(),
+		ServiceType:   shadow.ServiceType,
+		Route:         shadow.Route,
+		Method:        shadow.Method,
+		Path:          shadow.Path,
+		From:          from,
+		To:            to,
+		Reason:        reason,
+	}
+}
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File appends events as NDJSON lines. When the file would grow past
+// maxBytes it is renamed to path.1 (path.1 to path.2, and so on) and a new
+// one is started; only maxBackups old files are kept.
+type File struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// OpenFile appends to the file at path. maxBytes 0 never rotates.
+func OpenFile(path string, maxBytes int64, maxBackups int) (*File, error) {
+	f := &File{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := f.openLocked(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) openLocked() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *File) Send(topic string, value []byte) error {
+	line := newEvent(topic, value).line()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return fmt.Errorf("event file %s is closed", f.path)
+	}
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxBytes {
+		if err := f.rotateLocked(); err != nil {
+			return fmt.Errorf("rotating %s: %w", f.path, err)
+		}
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	return err
+}
+
+// rotateLocked shifts path.N to path.N+1, dropping the oldest, and starts a
+// new file at path.
+func (f *File) rotateLocked() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+		for i := f.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+	return f.openLocked()
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
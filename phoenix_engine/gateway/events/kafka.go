@@ -0,0 +1,252 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gateway/config"
+	"gateway/services"
+)
+
+const (
+	// kafkaRetryInterval is how often a missing producer is recreated and
+	// the outbox is retried.
+	kafkaRetryInterval = 2 * time.Second
+
+	// replayBatch is how many outbox events are produced per round trip.
+	replayBatch = 100
+)
+
+// KafkaStats combine the producer's delivery counters with the outbox.
+type KafkaStats struct {
+	services.KafkaStats
+	Connected bool         `json:"connected"` // A producer could be created
+	Spooled   int64        `json:"spooled"`   // Events written to the outbox
+	Replayed  int64        `json:"replayed"`  // Outbox events since delivered
+	Outbox    *OutboxStats `json:"outbox,omitempty"`
+}
+
+// Kafka produces events to the Kafka topic named by each event's topic.
+// While the brokers are unreachable, or older events still wait in the
+// outbox, new events are appended to the outbox as well; a background loop
+// replays them in order once Kafka accepts messages again. Failed delivery
+// reports are spooled the same way.
+type Kafka struct {
+	bootstrap    string
+	flushTimeout time.Duration
+	outbox       *Outbox // nil disables spooling
+
+	mu       sync.Mutex
+	service  *services.KafkaService // nil until a producer could be created
+	spooled  int64
+	replayed int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewKafka opens the outbox and starts the producer. A producer that cannot
+// be created yet is retried in the background while events are spooled.
+func NewKafka(cfg config.KafkaFile) (*Kafka, error) {
+	k := &Kafka{
+		bootstrap:    cfg.BootstrapServers,
+		flushTimeout: time.Duration(cfg.FlushTimeout),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	if cfg.Outbox != "" {
+		outbox, err := OpenOutbox(cfg.Outbox, int64(cfg.OutboxMaxMB)<<20)
+		if err != nil {
+			return nil, fmt.Errorf("kafka outbox: %w", err)
+		}
+		k.outbox = outbox
+		if pending := outbox.Pending(); pending > 0 {
+			log.Printf("Kafka outbox %s holds %d events from a previous run", cfg.Outbox, pending)
+		}
+	}
+
+	k.connect()
+	go k.run()
+	return k, nil
+}
+
+func (k *Kafka) connect() bool {
+	service, err := services.NewKafkaService(k.bootstrap, "", k.spool)
+	if err != nil {
+		log.Printf("Failed to create Kafka producer: %s. Retrying in %s...", err, kafkaRetryInterval)
+		return false
+	}
+	k.mu.Lock()
+	k.service = service
+	k.mu.Unlock()
+	return true
+}
+
+func (k *Kafka) Send(topic string, value []byte) error {
+	k.mu.Lock()
+	service := k.service
+	k.mu.Unlock()
+
+	if k.outbox == nil {
+		if service == nil {
+			return fmt.Errorf("no Kafka producer, %s event dropped", topic)
+		}
+		return service.SendMessageTo(topic, value)
+	}
+
+	// Keep order: nothing skips ahead of events already in the outbox
+	if service == nil || !service.Reachable() || k.outbox.Pending() > 0 {
+		return k.append(topic, value)
+	}
+	if err := service.SendMessageTo(topic, value); err != nil {
+		return k.append(topic, value)
+	}
+	return nil
+}
+
+// spool receives failed delivery reports from the producer.
+func (k *Kafka) spool(topic string, value []byte, cause error) {
+	if k.outbox == nil {
+		log.Printf("Kafka could not deliver %s event: %s", topic, cause)
+		return
+	}
+	if err := k.append(topic, value); err != nil {
+		log.Printf("Kafka could not deliver %s event (%s) and it was dropped: %s", topic, cause, err)
+	}
+}
+
+func (k *Kafka) append(topic string, value []byte) error {
+	if err := k.outbox.Append(topic, value); err != nil {
+		return fmt.Errorf("kafka outbox: %w", err)
+	}
+	k.mu.Lock()
+	k.spooled++
+	k.mu.Unlock()
+	return nil
+}
+
+func (k *Kafka) run() {
+	defer close(k.done)
+
+	ticker := time.NewTicker(kafkaRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+		}
+
+		k.mu.Lock()
+		service := k.service
+		k.mu.Unlock()
+
+		if service == nil {
+			if !k.connect() {
+				continue
+			}
+			k.mu.Lock()
+			service = k.service
+			k.mu.Unlock()
+		}
+		if k.outbox != nil {
+			k.replay(service)
+		}
+	}
+}
+
+// replay produces outbox events oldest first until the outbox is empty, a
+// batch fails or the sink is closing.
+func (k *Kafka) replay(service *services.KafkaService) {
+	total := 0
+	for k.outbox.Pending() > 0 {
+		select {
+		case <-k.stop:
+			return
+		default:
+		}
+
+		records, err := k.outbox.Peek(replayBatch)
+		if err != nil {
+			log.Printf("Failed to read Kafka outbox: %s", err)
+			return
+		}
+		topics := make([]string, len(records))
+		values := make([][]byte, len(records))
+		for i, record := range records {
+			topics[i] = record.Topic
+			values[i] = record.Value
+		}
+
+		n, err := service.SendBatchSync(topics, values)
+		if removeErr := k.outbox.Remove(records[:n]); removeErr != nil {
+			log.Printf("Failed to update Kafka outbox: %s", removeErr)
+		}
+		total += n
+		k.mu.Lock()
+		k.replayed += int64(n)
+		k.mu.Unlock()
+
+		if err != nil {
+			if total > 0 {
+				log.Printf("Replayed %d events from the Kafka outbox before Kafka failed again: %s", total, err)
+			}
+			return
+		}
+	}
+	if total > 0 {
+		log.Printf("Replayed %d events from the Kafka outbox", total)
+	}
+}
+
+// Stats reports delivery counters and the outbox.
+func (k *Kafka) Stats() KafkaStats {
+	k.mu.Lock()
+	stats := KafkaStats{Spooled: k.spooled, Replayed: k.replayed}
+	service := k.service
+	k.mu.Unlock()
+
+	if service != nil {
+		stats.KafkaStats = service.Stats()
+		stats.Connected = true
+	}
+	if k.outbox != nil {
+		outbox := k.outbox.Stats()
+		stats.Outbox = &outbox
+	}
+	return stats
+}
+
+// Close stops the replay loop and flushes queued events for up to the
+// configured flush timeout. Events that could not be flushed are spooled to
+// the outbox for the next run.
+func (k *Kafka) Close() error {
+	close(k.stop)
+	select {
+	case <-k.done:
+	case <-time.After(k.flushTimeout):
+	}
+
+	k.mu.Lock()
+	service := k.service
+	k.mu.Unlock()
+	if service != nil {
+		service.Close(k.flushTimeout)
+	}
+	select {
+	case <-k.done:
+	case <-time.After(k.flushTimeout):
+		log.Printf("Kafka outbox replay did not stop within %s", k.flushTimeout)
+	}
+
+	if k.outbox != nil {
+		if pending := k.outbox.Pending(); pending > 0 {
+			log.Printf("%d events stay in the Kafka outbox for the next start", pending)
+		}
+		return k.outbox.Close()
+	}
+	return nil
+}
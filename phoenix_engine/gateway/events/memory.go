@@ -0,0 +1,50 @@
+package events
+
+import "sync"
+
+// Memory keeps the most recent events in memory, for tests and for
+// GET /admin/events during local development.
+type Memory struct {
+	mu       sync.Mutex
+	events   []Event
+	capacity int
+}
+
+func NewMemory(capacity int) *Memory {
+	return &Memory{capacity: capacity}
+}
+
+func (m *Memory) Send(topic string, value []byte) error {
+	event := newEvent(topic, value)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	if len(m.events) > m.capacity {
+		m.events = append([]Event(nil), m.events[len(m.events)-m.capacity:]...)
+	}
+	return nil
+}
+
+// Events returns up to limit of the most recent events, newest first. An
+// empty topic matches every topic and limit 0 returns all of them.
+func (m *Memory) Events(topic string, limit int) []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := []Event{}
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if topic != "" && m.events[i].Topic != topic {
+			continue
+		}
+		list = append(list, m.events[i])
+		if limit > 0 && len(list) == limit {
+			break
+		}
+	}
+	return list
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,195 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// ErrOutboxFull is returned by Append once the outbox holds maxBytes.
+var ErrOutboxFull = errors.New("outbox is full")
+
+// OutboxStats describe what is waiting in the outbox.
+type OutboxStats struct {
+	Path    string `json:"path"`
+	Pending int    `json:"pending"` // Events waiting for replay
+	Bytes   int64  `json:"bytes"`
+	Dropped int64  `json:"dropped"` // Events refused because the outbox was full
+	Corrupt int64  `json:"corrupt"` // Unreadable lines skipped on replay
+}
+
+type outboxRecord struct {
+	Topic string `json:"topic"`
+	Value []byte `json:"value"`
+	size  int64
+}
+
+// Outbox is a bounded on-disk queue of events, one NDJSON line each, read
+// back oldest first. Replayed lines are skipped with an in-memory offset and
+// the file is compacted once the replayed part dominates it, so a restart
+// replays from the last compaction: delivery is at least once.
+type Outbox struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	file     *os.File
+	head     int64 // Offset of the oldest pending line
+	size     int64
+	pending  int
+	dropped  int64
+	corrupt  int64
+}
+
+// OpenOutbox opens or creates the outbox at path, keeping events left over
+// from before a restart.
+func OpenOutbox(path string, maxBytes int64) (*Outbox, error) {
+	o := &Outbox{path: path, maxBytes: maxBytes}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			o.size += int64(len(line))
+			o.pending++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	// Drop a torn last line from a crash mid-write
+	if err := file.Truncate(o.size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	o.file = file
+	return o, nil
+}
+
+// Append adds an event at the tail.
+func (o *Outbox) Append(topic string, value []byte) error {
+	line, err := json.Marshal(outboxRecord{Topic: topic, Value: value})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.size-o.head+int64(len(line)) > o.maxBytes {
+		o.dropped++
+		return ErrOutboxFull
+	}
+	if _, err := o.file.WriteAt(line, o.size); err != nil {
+		return err
+	}
+	o.size += int64(len(line))
+	o.pending++
+	return nil
+}
+
+// Pending reports how many events are waiting.
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pending
+}
+
+// Peek returns up to n of the oldest pending events without removing them.
+// Lines that do not decode to an event, e.g. one torn by a crash, are
+// dropped once they reach the head so they cannot block the events behind
+// them.
+func (o *Outbox) Peek(n int) ([]outboxRecord, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	reader := bufio.NewReader(io.NewSectionReader(o.file, o.head, o.size-o.head))
+	var records []outboxRecord
+	for len(records) < n {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return records, err
+		}
+		var record outboxRecord
+		if err := json.Unmarshal(line, &record); err != nil || record.Topic == "" {
+			// Remove only accounts for the records returned, so a bad line
+			// after them waits for the next Peek to reach the head
+			if len(records) > 0 {
+				break
+			}
+			if err == nil {
+				err = errors.New("no topic")
+			}
+			log.Printf("Skipping corrupt line at offset %d of outbox %s: %s", o.head, o.path, err)
+			o.head += int64(len(line))
+			o.pending--
+			o.corrupt++
+			continue
+		}
+		record.size = int64(len(line))
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Remove drops records, the leading ones a Peek returned, from the outbox.
+func (o *Outbox) Remove(records []outboxRecord) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, record := range records {
+		o.head += record.size
+		o.pending--
+	}
+	if o.pending == 0 {
+		o.head, o.size = 0, 0
+		return o.file.Truncate(0)
+	}
+	if o.head > o.size/2 {
+		return o.compactLocked()
+	}
+	return nil
+}
+
+// compactLocked moves the pending lines to the start of the file.
+func (o *Outbox) compactLocked() error {
+	remaining := make([]byte, o.size-o.head)
+	if _, err := o.file.ReadAt(remaining, o.head); err != nil {
+		return err
+	}
+	if _, err := o.file.WriteAt(remaining, 0); err != nil {
+		return err
+	}
+	if err := o.file.Truncate(int64(len(remaining))); err != nil {
+		return err
+	}
+	o.head, o.size = 0, int64(len(remaining))
+	return o.file.Sync()
+}
+
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return OutboxStats{Path: o.path, Pending: o.pending, Bytes: o.size - o.head, Dropped: o.dropped, Corrupt: o.corrupt}
+}
+
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.file.Close()
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutboxSkipsTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.ndjson")
+	// A line cut short mid-write, then a complete event behind it
+	data := `{"topic":"gateway-shadow","val` + "\n" + `{"topic":"gateway-shadow","value":"e30="}` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := OpenOutbox(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	records, err := o.Peek(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Topic != "gateway-shadow" || string(records[0].Value) != "{}" {
+		t.Fatalf("Peek returned %+v; want the one complete event", records)
+	}
+	if err := o.Remove(records); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := o.Stats()
+	if stats.Pending != 0 || stats.Corrupt != 1 {
+		t.Fatalf("pending %d, corrupt %d; want 0, 1", stats.Pending, stats.Corrupt)
+	}
+}
@@ -0,0 +1,30 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event is one event as the file, stdout and memory sinks keep it.
+type Event struct {
+	Time  time.Time       `json:"time"`
+	Topic string          `json:"topic"`
+	Event json.RawMessage `json:"event"`
+}
+
+func newEvent(topic string, value []byte) Event {
+	event := Event{Time: time.Now().UTC(), Topic: topic}
+	if json.Valid(value) {
+		event.Event = append(json.RawMessage(nil), value...)
+	} else {
+		// Keep non-JSON payloads readable instead of failing the line
+		event.Event, _ = json.Marshal(string(value))
+	}
+	return event
+}
+
+// line encodes e as one NDJSON line.
+func (e Event) line() []byte {
+	data, _ := json.Marshal(e)
+	return append(data, '\n')
+}
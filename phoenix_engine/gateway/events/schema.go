@@ -0,0 +1,30 @@
+package events
+
+import (
+	"embed"
+	"sort"
+	"strings"
+)
+
+// schemaFiles holds the published JSON Schema of every event type, named
+// after its event_type.
+//
+//go:embed schema/*.json
+var schemaFiles embed.FS
+
+// Schema returns the JSON Schema for an event type.
+func Schema(eventType string) ([]byte, bool) {
+	data, err := schemaFiles.ReadFile("schema/" + eventType + ".json")
+	return data, err == nil
+}
+
+// SchemaTypes lists the event types that have a schema.
+func SchemaTypes() []string {
+	entries, _ := schemaFiles.ReadDir("schema")
+	types := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		types = append(types, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(types)
+	return types
+}
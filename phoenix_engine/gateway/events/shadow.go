@@ -0,0 +1,145 @@
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// ShadowSchemaVersion is the version of ShadowEvent. Adding an optional
+// field keeps it; renaming, removing or retyping a field bumps it. Version 1
+// was the untyped event without schema_version.
+const ShadowSchemaVersion = 2
+
+// ShadowEventType is the event_type of every ShadowEvent.
+const ShadowEventType = "shadow-request"
+
+// Modes a ShadowEvent reports.
+const (
+	ModeLegacyOnly          = "legacy-only"           // Client asked for legacy
+	ModeModernOnly          = "modern-only"           // Client asked for modern
+	ModeShadowingLegacyOnly = "shadowing-legacy-only" // Not sampled, legacy primary
+	ModeShadowingModernOnly = "shadowing-modern-only" // Not sampled, modern primary
+	ModeShadowing           = "shadowing"             // Both backends called and compared
+)
+
+// ShadowEvent is published to the shadow topic once per proxied request, in
+// every mode. Every field is always present unless marked omitempty; a
+// backend that was not called is null.
+type ShadowEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	EventType     string    `json:"event_type"`
+	TransactionID string    `json:"transaction_id"`
+	TraceID       string    `json:"trace_id,omitempty"` // W3C trace the request belongs to
+	Timestamp     time.Time `json:"timestamp"`
+
+	ServiceType string `json:"service_type"`
+	Route       string `json:"route"` // Route rule that matched, e.g. "POST /transfer"
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	AccountKey  string `json:"account_key,omitempty"` // Sticky key value, or the body's account_number
+	ClientIP    string `json:"client_ip"`
+	RequestHash string `json:"request_hash"`
+
+	Mode          string  `json:"mode"`
+	PrimaryTarget string  `json:"primary_target"` // "legacy" or "modern"
+	Weight        float64 `json:"weight"`
+	ShadowSample  float64 `json:"shadow_sample"`
+
+	Legacy *BackendResult `json:"legacy"`
+	Modern *BackendResult `json:"modern"`
+
+	// Fallback is set when the primary failed and the client got the other
+	// backend's response instead.
+	Fallback *Fallback `json:"fallback,omitempty"`
+
+	// Compared is true when both backends were called. Match and the diff
+	// fields are only set then.
+	Compared      bool     `json:"compared"`
+	Match         *bool    `json:"match,omitempty"`
+	BodyMatch     *bool    `json:"body_match,omitempty"`
+	DiffPaths     []string `json:"diff_paths,omitempty"`
+	DiffTruncated bool     `json:"diff_truncated,omitempty"`
+
+	// Flat copies of Legacy and Modern for consumers written against
+	// version 1; 0 when that backend was not called or failed.
+	LegacyStatus  int     `json:"legacy_status"`
+	ModernStatus  int     `json:"modern_status"`
+	LegacyLatency float64 `json:"legacy_latency"`
+	ModernLatency float64 `json:"modern_latency"`
+}
+
+// BackendResult is one backend's side of a request.
+type BackendResult struct {
+	Status     int     `json:"status"`  // 0 when no response arrived
+	Latency    float64 `json:"latency"` // Seconds
+	BodyBytes  int     `json:"body_bytes"`
+	BodyHash   string  `json:"body_hash,omitempty"`
+	ErrorClass string  `json:"error_class,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Fallback records that the client was answered by To because From, the
+// primary, failed with Reason, one of the error classes.
+type Fallback struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
+
+func NewShadowEvent(txID string) *ShadowEvent {
+	return &ShadowEvent{
+		SchemaVersion: ShadowSchemaVersion,
+		EventType:     ShadowEventType,
+		TransactionID: txID,
+		Timestamp:     time.Now().UTC(),
+	}
+}
+
+// NewBackendResult describes one backend call: status and body when a
+// response arrived, err when it did not.
+func NewBackendResult(status int, body []byte, err error, duration time.Duration) BackendResult {
+	result := BackendResult{
+		Status:  status,
+		Latency: duration.Seconds(),
+	}
+	if err != nil {
+		result.Status = 0
+		result.ErrorClass = ClassifyError(err)
+		result.Error = err.Error()
+		return result
+	}
+	result.BodyBytes = len(body)
+	result.BodyHash = HashBody(body)
+	if status >= 500 {
+		result.ErrorClass = ErrorHTTP5xx
+	}
+	return result
+}
+
+func (e *ShadowEvent) SetLegacy(result BackendResult) {
+	e.Legacy = &result
+	e.LegacyStatus = result.Status
+	e.LegacyLatency = result.Latency
+}
+
+func (e *ShadowEvent) SetModern(result BackendResult) {
+	e.Modern = &result
+	e.ModernStatus = result.Status
+	e.ModernLatency = result.Latency
+}
+
+// SetPrimary records which backend's response the client got.
+func (e *ShadowEvent) SetPrimary(useModern bool) {
+	e.PrimaryTarget = "legacy"
+	if useModern {
+		e.PrimaryTarget = "modern"
+	}
+}
+
+// HashBody returns "sha256:<hex>" of body, so consumers can tell identical
+// payloads apart without the event carrying them.
+func HashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
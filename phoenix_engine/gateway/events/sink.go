@@ -0,0 +1,65 @@
+// Package events delivers the events the gateway emits (shadow comparisons,
+// audit entries) to one or more sinks: Kafka, an NDJSON file, stdout, an HTTP
+// webhook or memory.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Sink receives encoded events. topic names the kind of event: Kafka produces
+// to it, the other sinks record it next to the event.
+type Sink interface {
+	Send(topic string, value []byte) error
+	Close() error
+}
+
+// Fanout sends every event to all of its sinks. One sink failing does not
+// stop the others.
+type Fanout []Sink
+
+func (f Fanout) Send(topic string, value []byte) error {
+	var failures []string
+	for _, sink := range f {
+		if err := sink.Send(topic, value); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d sinks failed: %s", len(failures), len(f), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (f Fanout) Close() error {
+	var failures []string
+	for _, sink := range f {
+		if err := sink.Close(); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("closing sinks: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Publisher encodes events as JSON and sends them to a sink under one topic.
+// The zero Publisher drops everything.
+type Publisher struct {
+	Sink  Sink
+	Topic string
+}
+
+func (p Publisher) Publish(event interface{}) error {
+	if p.Sink == nil {
+		return nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return p.Sink.Send(p.Topic, data)
+}
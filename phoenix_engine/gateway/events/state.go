@@ -0,0 +1,50 @@
+package events
+
+import "time"
+
+// StateSchemaVersion is the version of StateEvent.
+const StateSchemaVersion = 1
+
+// StateEventType is the event_type of every StateEvent.
+const StateEventType = "db-state-update"
+
+// StateEvent is published to the state topic after both backends answered
+// a shadowed write, so consumers can reconcile the rows it touched. Keys
+// holds the business keys read from the request body.
+type StateEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	EventType     string    `json:"event_type"`
+	TransactionID string    `json:"transaction_id"`
+	Timestamp     time.Time `json:"timestamp"`
+
+	ServiceType string            `json:"service_type"`
+	Route       string            `json:"route"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	Keys        map[string]string `json:"keys"`
+
+	// AccountNumber repeats Keys["account_number"] for consumers that
+	// reconcile accounts.
+	AccountNumber string `json:"account_number,omitempty"`
+
+	LegacyStatus int `json:"legacy_status"`
+	ModernStatus int `json:"modern_status"`
+}
+
+// NewStateEvent derives the state event for a compared shadow event.
+func NewStateEvent(shadow *ShadowEvent, keys map[string]string) *StateEvent {
+	return &StateEvent{
+		SchemaVersion: StateSchemaVersion,
+		EventType:     StateEventType,
+		TransactionID: shadow.TransactionID,
+		Timestamp:     time.Now().UTC(),
+		ServiceType:   shadow.ServiceType,
+		Route:         shadow.Route,
+		Method:        shadow.Method,
+		Path:          shadow.Path,
+		Keys:          keys,
+		AccountNumber: keys["account_number"],
+		LegacyStatus:  shadow.LegacyStatus,
+		ModernStatus:  shadow.ModernStatus,
+	}
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// webhookQueue bounds how many events wait for delivery. Events beyond it
+// are dropped so a slow endpoint never holds up requests.
+const webhookQueue = 1000
+
+type webhookEvent struct {
+	topic string
+	value []byte
+}
+
+// Webhook POSTs each event's JSON to a URL from a background goroutine. The
+// topic is sent in the X-Event-Topic header.
+type Webhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan webhookEvent
+	done   chan struct{}
+}
+
+func NewWebhook(url string, timeout time.Duration, headers map[string]string) *Webhook {
+	wh := &Webhook{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+		queue:   make(chan webhookEvent, webhookQueue),
+		done:    make(chan struct{}),
+	}
+	go wh.run()
+	return wh
+}
+
+func (wh *Webhook) Send(topic string, value []byte) error {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if wh.closed {
+		return fmt.Errorf("webhook %s is closed", wh.url)
+	}
+	select {
+	case wh.queue <- webhookEvent{topic: topic, value: value}:
+		return nil
+	default:
+		return fmt.Errorf("webhook %s queue is full, event dropped", wh.url)
+	}
+}
+
+func (wh *Webhook) run() {
+	defer close(wh.done)
+	for event := range wh.queue {
+		if err := wh.post(event); err != nil {
+			log.Printf("Failed to deliver %s event to webhook: %s", event.topic, err)
+		}
+	}
+}
+
+func (wh *Webhook) post(event webhookEvent) error {
+	req, err := http.NewRequest(http.MethodPost, wh.url, bytes.NewReader(event.value))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Topic", event.topic)
+	for key, value := range wh.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %d", wh.url, resp.StatusCode)
+	}
+	return nil
+}
+
+// Close stops accepting events and waits for the queued ones to be posted.
+func (wh *Webhook) Close() error {
+	wh.mu.Lock()
+	if !wh.closed {
+		wh.closed = true
+		close(wh.queue)
+	}
+	wh.mu.Unlock()
+
+	<-wh.done
+	return nil
+}
@@ -0,0 +1,35 @@
+package events
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// Writer writes events as NDJSON lines to an io.Writer, e.g. stdout.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Stdout prints events to standard output, for local development.
+func Stdout() *Writer {
+	return NewWriter(os.Stdout)
+}
+
+func (s *Writer) Send(topic string, value []byte) error {
+	line := newEvent(topic, value).line()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(line)
+	return err
+}
+
+func (s *Writer) Close() error {
+	return nil
+}
@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strings"
 
+	"gateway/breaker"
 	"gateway/config"
+	"gateway/health"
 	"gateway/types"
 )
 
@@ -13,21 +17,32 @@ func SetWeightHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == http.MethodGet {
-		service := r.URL.Query().Get("service")
-		var weight float64
-
-		if service == "python" {
-			weight = config.GlobalConfig.GetPythonWeight()
-		} else if service == "php" {
-			weight = config.GlobalConfig.GetPhpWeight()
-		} else {
-			http.Error(w, "Invalid service", http.StatusBadRequest)
+		query := r.URL.Query()
+		service := query.Get("service")
+
+		if query.Get("path") == "" {
+			m, ok := config.GlobalConfig.GetMigration(service)
+			if !ok {
+				http.Error(w, "Invalid service", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(types.WeightResponse{
+				Service: service,
+				Weight:  m.Weight,
+			})
 			return
 		}
 
+		// Reports the weight that applies to the route after longest-match lookup
+		target, ok := config.GlobalConfig.ResolveIn(service, query.Get("method"), query.Get("path"))
+		if !ok {
+			http.Error(w, "Invalid service", http.StatusBadRequest)
+			return
+		}
 		json.NewEncoder(w).Encode(types.WeightResponse{
 			Service: service,
-			Weight:  weight,
+			Route:   target.Route,
+			Weight:  target.Weight,
 		})
 		return
 	}
@@ -43,29 +58,158 @@ func SetWeightHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Service == "python" {
-		config.GlobalConfig.SetPythonWeight(req.Weight)
-		log.Printf("Updated Python weight to %.2f%%", req.Weight*100)
-	} else if req.Service == "php" {
-		config.GlobalConfig.SetPhpWeight(req.Weight)
-		log.Printf("Updated PHP weight to %.2f%%", req.Weight*100)
-	} else {
-		http.Error(w, "Invalid service type", http.StatusBadRequest)
+	if req.Path == "" {
+		old, err := config.GlobalConfig.SetWeight(req.Service, req.Weight)
+		if err != nil {
+			writeWeightError(w, err)
+			return
+		}
+		slog.Info("weight updated", "service", req.Service, "weight", req.Weight)
+		recordChange(r, "set-weight", req.Service, "", old, req.Weight, req.Reason)
+		if !persistState(w) {
+			return
+		}
+
+		json.NewEncoder(w).Encode(types.WeightResponse{
+			Service: req.Service,
+			Weight:  req.Weight,
+		})
+		return
+	}
+
+	old, err := config.GlobalConfig.SetRouteWeight(req.Service, req.Method, req.Path, req.Weight)
+	if err != nil {
+		writeWeightError(w, err)
+		return
+	}
+	rule := config.RouteRule{Method: strings.ToUpper(req.Method), Path: req.Path}
+	slog.Info("weight updated", "service", req.Service, "route", rule.Key(), "weight", req.Weight)
+	recordChange(r, "set-weight", req.Service, rule.Key(), old, req.Weight, req.Reason)
+	if !persistState(w) {
 		return
 	}
 
 	json.NewEncoder(w).Encode(types.WeightResponse{
 		Service: req.Service,
+		Route:   rule.Key(),
 		Weight:  req.Weight,
 	})
 }
 
+// ShadowSampleHandler reads (GET) or sets (POST) how many requests are
+// mirrored to the backend that is not primary, independent of the weight.
+func ShadowSampleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		service := query.Get("service")
+
+		if query.Get("path") == "" {
+			m, ok := config.GlobalConfig.GetMigration(service)
+			if !ok {
+				http.Error(w, "Invalid service", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(types.ShadowSampleResponse{
+				Service: service,
+				Sample:  m.EffectiveShadowSample(nil),
+			})
+			return
+		}
+
+		target, ok := config.GlobalConfig.ResolveIn(service, query.Get("method"), query.Get("path"))
+		if !ok {
+			http.Error(w, "Invalid service", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(types.ShadowSampleResponse{
+			Service: service,
+			Route:   target.Route,
+			Sample:  target.ShadowSample,
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req types.ShadowSampleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	route := ""
+	var old *float64
+	var err error
+	if req.Path == "" {
+		old, err = config.GlobalConfig.SetShadowSample(req.Service, req.Sample)
+	} else {
+		rule := config.RouteRule{Method: strings.ToUpper(req.Method), Path: req.Path}
+		route = rule.Key()
+		old, err = config.GlobalConfig.SetRouteShadowSample(req.Service, req.Method, req.Path, req.Sample)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m, _ := config.GlobalConfig.GetMigration(req.Service)
+	sample := m.EffectiveShadowSample(nil)
+	if route != "" {
+		rule, _ := m.Route(req.Method, req.Path)
+		sample = m.EffectiveShadowSample(&rule)
+	}
+	slog.Info("shadow sample updated", "service", req.Service, "route", route, "shadow_sample", sample)
+	recordChange(r, "shadow-sample", req.Service, route, old, req.Sample, req.Reason)
+	if !persistState(w) {
+		return
+	}
+
+	json.NewEncoder(w).Encode(types.ShadowSampleResponse{
+		Service: req.Service,
+		Route:   route,
+		Sample:  sample,
+	})
+}
+
 func TrafficLockHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == http.MethodGet {
-		locked := config.GlobalConfig.IsTrafficLocked()
-		json.NewEncoder(w).Encode(types.TrafficLockResponse{Locked: locked})
+		query := r.URL.Query()
+		service := query.Get("service")
+		if service == "" {
+			locked := config.GlobalConfig.IsTrafficLocked()
+			json.NewEncoder(w).Encode(types.TrafficLockResponse{Locked: locked})
+			return
+		}
+
+		if query.Get("path") == "" {
+			if _, ok := config.GlobalConfig.GetMigration(service); !ok {
+				http.Error(w, "Invalid service", http.StatusBadRequest)
+				return
+			}
+			locked := config.GlobalConfig.IsMigrationLocked(service)
+			json.NewEncoder(w).Encode(types.TrafficLockResponse{Service: service, Locked: locked})
+			return
+		}
+
+		// Reports the effective lock, including the global and service locks
+		target, ok := config.GlobalConfig.ResolveIn(service, query.Get("method"), query.Get("path"))
+		if !ok {
+			http.Error(w, "Invalid service", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(types.TrafficLockResponse{
+			Service: service,
+			Method:  query.Get("method"),
+			Path:    query.Get("path"),
+			Locked:  target.Locked,
+		})
 		return
 	}
 
@@ -76,9 +220,38 @@ func TrafficLockHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		config.GlobalConfig.SetTrafficLocked(req.Locked)
-		log.Printf("Traffic lock updated: %v", req.Locked)
-		json.NewEncoder(w).Encode(types.TrafficLockResponse{Locked: req.Locked})
+		switch {
+		case req.Service == "":
+			old := config.GlobalConfig.SetTrafficLocked(req.Locked)
+			slog.Info("traffic lock updated", "locked", req.Locked)
+			recordChange(r, "traffic-lock", "", "", old, req.Locked, req.Reason)
+		case req.Path == "":
+			old, err := config.GlobalConfig.SetMigrationLocked(req.Service, req.Locked)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			slog.Info("traffic lock updated", "service", req.Service, "locked", req.Locked)
+			recordChange(r, "traffic-lock", req.Service, "", old, req.Locked, req.Reason)
+		default:
+			old, err := config.GlobalConfig.SetRouteLocked(req.Service, req.Method, req.Path, req.Locked)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			rule := config.RouteRule{Method: strings.ToUpper(req.Method), Path: req.Path}
+			slog.Info("traffic lock updated", "service", req.Service, "route", rule.Key(), "locked", req.Locked)
+			recordChange(r, "traffic-lock", req.Service, rule.Key(), old, req.Locked, req.Reason)
+		}
+		if !persistState(w) {
+			return
+		}
+		json.NewEncoder(w).Encode(types.TrafficLockResponse{
+			Service: req.Service,
+			Method:  req.Method,
+			Path:    req.Path,
+			Locked:  req.Locked,
+		})
 		return
 	}
 
@@ -102,39 +275,102 @@ func StatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	phpWeight := config.GlobalConfig.GetPhpWeight()
-	pythonWeight := config.GlobalConfig.GetPythonWeight()
-	trafficLocked := config.GlobalConfig.IsTrafficLocked()
+	stateStore, stateSource := config.GlobalConfig.StateInfo()
 
-	// Determine migration status based on weights
-	phpStatus := "pending"
-	if phpWeight >= 1.0 {
-		phpStatus = "complete"
-	} else if phpWeight > 0 {
-		phpStatus = "in_progress"
+	// Migration names are restricted to [a-z0-9-], so they never collide
+	// with the snake_case gateway-wide keys below.
+	status := map[string]interface{}{
+		"traffic_locked": config.GlobalConfig.IsTrafficLocked(),
+		"state_store":    stateStore,
+		"state_source":   stateSource,
 	}
 
-	pythonStatus := "pending"
-	if pythonWeight >= 1.0 {
-		pythonStatus = "complete"
-	} else if pythonWeight > 0 {
-		pythonStatus = "in_progress"
+	rollouts := config.GlobalConfig.ListRollouts()
+	migrations := config.GlobalConfig.ListMigrations()
+	breakers := map[string]breaker.Status{}
+	for _, b := range breaker.Global.Status(migrations) {
+		breakers[b.Service] = b
+	}
+	backends := map[string]map[string]health.Status{}
+	for _, b := range health.Global.Status() {
+		if backends[b.Service] == nil {
+			backends[b.Service] = map[string]health.Status{}
+		}
+		backends[b.Service][b.Backend] = b
 	}
 
-	status := map[string]interface{}{
-		"php": map[string]interface{}{
-			"weight":           phpWeight,
-			"weight_percent":   phpWeight * 100,
-			"migration_status": phpStatus,
-		},
-		"python": map[string]interface{}{
-			"weight":           pythonWeight,
-			"weight_percent":   pythonWeight * 100,
-			"migration_status": pythonStatus,
-		},
-		"traffic_locked": trafficLocked,
+	for _, m := range migrations {
+		routes := make([]map[string]interface{}, 0, len(m.Routes))
+		for _, rule := range m.Routes {
+			weight := m.Weight
+			if rule.Weight != nil {
+				weight = *rule.Weight
+			}
+			sample := m.EffectiveShadowSample(&rule)
+			routes = append(routes, map[string]interface{}{
+				"method":                rule.Method,
+				"path":                  rule.Path,
+				"weight":                weight,
+				"weight_percent":        weight * 100,
+				"shadow_sample_percent": sample * 100,
+				"migration_status":      migrationStatus(weight),
+				"traffic_locked":        rule.TrafficLocked,
+				"inherits_weight":       rule.Weight == nil,
+			})
+		}
+
+		service := map[string]interface{}{
+			"weight":                m.Weight,
+			"weight_percent":        m.Weight * 100,
+			"shadow_sample_percent": m.EffectiveShadowSample(nil) * 100,
+			"migration_status":      migrationStatus(m.Weight),
+			"traffic_locked":        m.TrafficLocked,
+			"path_prefix":           m.PathPrefix,
+			"legacy_url":            m.LegacyURL,
+			"modern_url":            m.ModernURL,
+			"routes":                routes,
+			"rollouts":              rolloutStatus(rollouts, m.Name),
+		}
+		if b, ok := breakers[m.Name]; ok {
+			service["circuit_breaker"] = b.State
+		}
+		if h, ok := backends[m.Name]; ok {
+			service["health"] = h
+		}
+		status[m.Name] = service
 	}
 
 	json.NewEncoder(w).Encode(status)
 }
 
+// migrationStatus derives the migration status from a weight
+func migrationStatus(weight float64) string {
+	if weight >= 1.0 {
+		return "complete"
+	} else if weight > 0 {
+		return "in_progress"
+	}
+	return "pending"
+}
+
+// writeWeightError answers a rejected weight change: 409 while a rollout
+// plan drives the weight, 400 otherwise.
+func writeWeightError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, config.ErrRolloutActive) {
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// persistState saves the routing state after an admin change. If the store
+// rejects the write it answers 500 and returns false; the change itself is
+// already live in memory.
+func persistState(w http.ResponseWriter) bool {
+	if err := config.GlobalConfig.Persist(); err != nil {
+		slog.Error("failed to persist routing state", "error", err)
+		http.Error(w, "Change applied but not persisted: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
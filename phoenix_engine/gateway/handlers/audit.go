@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gateway/audit"
+	"gateway/auth"
+)
+
+// recordChange appends an admin change to the audit log. The reason comes
+// from the request body, or from the X-Change-Reason header for requests
+// without one (e.g. DELETE).
+func recordChange(r *http.Request, action, service, route string, oldValue, newValue interface{}, reason string) {
+	if reason == "" {
+		reason = r.Header.Get("X-Change-Reason")
+	}
+
+	audit.GlobalLog.Record(audit.Entry{
+		Actor:    requestActor(r),
+		SourceIP: sourceIP(r),
+		Action:   action,
+		Service:  service,
+		Route:    route,
+		OldValue: oldValue,
+		NewValue: newValue,
+		Reason:   reason,
+	})
+}
+
+// requestActor names who made the change: the authenticated principal, or
+// the X-Actor header when admin authentication is disabled.
+func requestActor(r *http.Request) string {
+	if p := auth.PrincipalFrom(r.Context()); p != nil {
+		return p.Method + ":" + p.Name
+	}
+	if actor := r.Header.Get("X-Actor"); actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// AuditHandler serves GET /admin/audit, newest entries first. Supported
+// filters: actor, action, service, since and until (RFC 3339) and limit
+// (default 100).
+func AuditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:   query.Get("actor"),
+		Action:  query.Get("action"),
+		Service: query.Get("service"),
+		Limit:   100,
+	}
+
+	var err error
+	if v := query.Get("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "until must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			http.Error(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(audit.GlobalLog.Query(filter))
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"gateway/breaker"
+	"gateway/config"
+	"gateway/metrics"
+	"gateway/types"
+)
+
+// observeModern feeds the outcome of a modern call to the service's
+// circuit breaker. A call canceled because the client hung up says nothing
+// about modern and is left out.
+func observeModern(target config.RouteTarget, resp *http.Response, err error, duration time.Duration) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	breaker.Global.Record(target, status, err, duration)
+}
+
+// rejectBreakerOpen answers an explicit modern-mode request with 503 while
+// the service's breaker keeps modern out of traffic, and reports whether it
+// did. Shadowing requests are routed to legacy by Admit instead.
+func rejectBreakerOpen(w http.ResponseWriter, logger *slog.Logger, target config.RouteTarget, mode string) bool {
+	if mode != "modern" || !target.BreakerOpen {
+		return false
+	}
+	logger.Warn("request rejected: circuit breaker open", "mode", mode)
+	http.Error(w, "Circuit breaker open: modern mode not available. Use 'legacy' or 'shadowing'.", http.StatusServiceUnavailable)
+	metrics.ObserveRejected(target.Service, target.Route, eventMode(mode), http.StatusServiceUnavailable)
+	return true
+}
+
+// CircuitBreakerHandler reports the breaker of every migration that has one
+// (GET /admin/circuit-breakers) and closes one again on operator request
+// (POST /admin/circuit-breakers/reset).
+func CircuitBreakerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.URL.Path == "/admin/circuit-breakers" && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(breaker.Global.Status(config.GlobalConfig.ListMigrations()))
+	case r.URL.Path == "/admin/circuit-breakers/reset" && r.Method == http.MethodPost:
+		var req types.BreakerResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := config.GlobalConfig.GetMigration(req.Service); !ok {
+			http.Error(w, "Invalid service", http.StatusBadRequest)
+			return
+		}
+		old := breaker.Global.Reset(req.Service)
+		slog.Info("circuit breaker reset", "service", req.Service, "was", old)
+		recordChange(r, "breaker-reset", req.Service, "", old, breaker.Closed, req.Reason)
+		json.NewEncoder(w).Encode(map[string]string{"service": req.Service, "state": breaker.Closed})
+	case r.URL.Path == "/admin/circuit-breakers" || r.URL.Path == "/admin/circuit-breakers/reset":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
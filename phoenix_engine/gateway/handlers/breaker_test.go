@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gateway/breaker"
+	"gateway/config"
+)
+
+func TestOpenBreakerServesShadowingFromLegacy(t *testing.T) {
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "legacy")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer legacy.Close()
+
+	var modernCalls int32
+	modern := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&modernCalls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer modern.Close()
+
+	target := config.RouteTarget{
+		Service:       "breaker-test",
+		Path:          "/accounts",
+		LegacyURL:     legacy.URL,
+		ModernURL:     modern.URL,
+		Weight:        1,
+		ShadowSample:  1,
+		LegacyTimeout: time.Second,
+		ModernTimeout: time.Second,
+		Compare:       config.DefaultCompareRules(),
+		Upstream:      config.Upstream{}.WithDefaults(),
+		CircuitBreaker: &config.CircuitBreaker{
+			ErrorRate:    0.5,
+			MinRequests:  1,
+			OpenDuration: config.Duration(time.Hour),
+		},
+	}
+	defer breaker.Global.Reset(target.Service)
+	breaker.Global.Record(target, 0, errors.New("connection refused"), time.Millisecond)
+
+	r := httptest.NewRequest(http.MethodPost, "/breaker-test/accounts", strings.NewReader(`{"mode":"shadowing"}`))
+	w := httptest.NewRecorder()
+	HandleDynamicTransfer(w, r, breaker.Global.Admit(target), Publishers{})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d; want 200", w.Code)
+	}
+	if got := w.Header().Get("X-Backend"); got != "legacy" {
+		t.Fatalf("served by %q; want legacy", got)
+	}
+	if n := atomic.LoadInt32(&modernCalls); n != 0 {
+		t.Fatalf("modern got %d calls through an open breaker", n)
+	}
+}
+
+func TestOpenBreakerRejectsModernMode(t *testing.T) {
+	var modernCalls int32
+	modern := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&modernCalls, 1)
+	}))
+	defer modern.Close()
+
+	target := config.RouteTarget{
+		Service:       "breaker-modern-test",
+		Path:          "/accounts",
+		LegacyURL:     modern.URL,
+		ModernURL:     modern.URL,
+		LegacyTimeout: time.Second,
+		ModernTimeout: time.Second,
+		Compare:       config.DefaultCompareRules(),
+		Upstream:      config.Upstream{}.WithDefaults(),
+		CircuitBreaker: &config.CircuitBreaker{
+			ErrorRate:    0.5,
+			MinRequests:  1,
+			OpenDuration: config.Duration(time.Hour),
+		},
+	}
+	defer breaker.Global.Reset(target.Service)
+	breaker.Global.Record(target, 0, errors.New("connection refused"), time.Millisecond)
+
+	r := httptest.NewRequest(http.MethodGet, "/breaker-modern-test/accounts?mode=modern", nil)
+	w := httptest.NewRecorder()
+	HandleDynamicTransfer(w, r, breaker.Global.Admit(target), Publishers{})
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d; want 503", w.Code)
+	}
+	if n := atomic.LoadInt32(&modernCalls); n != 0 {
+		t.Fatalf("modern got %d calls through an open breaker", n)
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gateway/compare"
+	"gateway/config"
+	"gateway/events"
+)
+
+// addComparison adds the verdict for a shadowed request to its event. A nil
+// response means that backend failed, which is always a mismatch.
+func addComparison(event *events.ShadowEvent, target config.RouteTarget, legacyResp *http.Response, legacyBody []byte, modernResp *http.Response, modernBody []byte) {
+	event.Compared = true
+	if legacyResp == nil || modernResp == nil {
+		match := false
+		event.Match = &match
+		return
+	}
+
+	result := compare.JSON(legacyBody, modernBody, target.Compare)
+	match := legacyResp.StatusCode == modernResp.StatusCode && result.Match
+	event.Match = &match
+	event.BodyMatch = &result.Match
+	event.DiffPaths = result.DiffPaths
+	event.DiffTruncated = result.Truncated
+}
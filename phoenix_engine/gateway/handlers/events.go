@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gateway/events"
+)
+
+// EventsHandler serves GET /admin/events from the memory sink, newest first.
+// Supported filters: topic and limit (default 100).
+func EventsHandler(recent *events.Memory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+				http.Error(w, "limit must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+		}
+
+		json.NewEncoder(w).Encode(recent.Events(r.URL.Query().Get("topic"), limit))
+	}
+}
+
+// EventSinksHandler serves GET /admin/event-sinks: the configured sinks and
+// Kafka's delivery counters and outbox.
+func EventSinksHandler(sinks *events.Sinks) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		response := map[string]interface{}{
+			"sinks": sinks.Counts(),
+		}
+		if sinks.Kafka != nil {
+			response["kafka"] = sinks.Kafka.Stats()
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// EventSchemaHandler serves the published JSON Schemas: GET
+// /admin/event-schemas lists the event types, GET
+// /admin/event-schemas/{event_type} returns one schema.
+func EventSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventType := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/event-schemas"), "/")
+	if eventType == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events.SchemaTypes())
+		return
+	}
+
+	schema, ok := events.Schema(eventType)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(schema)
+}
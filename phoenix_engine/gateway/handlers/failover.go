@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"gateway/config"
+	"gateway/events"
+	"gateway/health"
+	"gateway/metrics"
+)
+
+// failoverHeader marks a response served by the other backend, e.g.
+// "modern->legacy".
+const failoverHeader = "X-Gateway-Failover"
+
+// failover reports whether the request must go to the other backend because
+// the primary the weight chose is failing its health checks and the other
+// one is not. The caller then serves it from that backend alone; a shadow
+// copy would only go to the unhealthy one.
+func failover(w http.ResponseWriter, logger *slog.Logger, target config.RouteTarget, useModern bool, event *events.ShadowEvent, publisher events.Publisher) bool {
+	from, to := "legacy", "modern"
+	if useModern {
+		from, to = "modern", "legacy"
+	}
+	if health.Global.Healthy(target.Service, from) || !health.Global.Healthy(target.Service, to) {
+		return false
+	}
+
+	w.Header().Set(failoverHeader, from+"->"+to)
+	logger.Warn("primary unhealthy, failing over", "from", from, "to", to)
+	metrics.ObserveFailover(target.Service, target.Route, from, to)
+	if err := publisher.Publish(events.NewFailoverEvent(event, from, to, "health check failing")); err != nil {
+		logger.Error("failed to send failover event", "error", err)
+	}
+	return true
+}
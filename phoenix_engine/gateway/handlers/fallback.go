@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"gateway/config"
+	"gateway/events"
+	"gateway/logging"
+)
+
+// fallbackHeader marks a response answered by the other backend because
+// the primary failed, e.g. "modern->legacy".
+const fallbackHeader = "X-Gateway-Fallback"
+
+// fallbackReason returns the primary's error class when policy falls back
+// on its failure, or "" when the client gets the primary's answer. A call
+// canceled by the client never falls back.
+func fallbackReason(policy config.FallbackPolicy, primary upstreamResult) string {
+	var class, failure string
+	switch {
+	case primary.err != nil:
+		class = events.ClassifyError(primary.err)
+		switch class {
+		case events.ErrorCanceled:
+			return ""
+		case events.ErrorTimeout:
+			failure = config.FallbackTimeout
+		default:
+			failure = config.FallbackConnectionError
+		}
+	case primary.resp.StatusCode >= 500:
+		class, failure = events.ErrorHTTP5xx, config.Fallback5xx
+	default:
+		return ""
+	}
+	if !policy.Allows(failure) {
+		return ""
+	}
+	return class
+}
+
+// usable reports whether res may answer the client in place of a failed
+// primary.
+func (res upstreamResult) usable() bool {
+	return res.err == nil && res.resp.StatusCode < 500
+}
+
+// useFallback tags the response and the event as answered by to.
+func useFallback(w http.ResponseWriter, logger *slog.Logger, event *events.ShadowEvent, from, to, reason string) {
+	w.Header().Set(fallbackHeader, from+"->"+to)
+	event.Fallback = &events.Fallback{From: from, To: to, Reason: reason}
+	logger.Warn("primary failed, answering from the other backend", "from", from, "to", to, "reason", reason)
+}
+
+// resendAllowed reports whether a request the primary may already have
+// applied can be sent to the other backend. Reads always can; writes only
+// on routes with fallback_writes, and never after a timeout, where the
+// primary most likely went on to apply it.
+func resendAllowed(r *http.Request, target config.RouteTarget, reason string) bool {
+	if !isWrite(r.Method) {
+		return true
+	}
+	return target.FallbackWrites && reason != events.ErrorTimeout
+}
+
+// callFallback is for shadowing-mode requests sent to the primary alone.
+// When target.Fallback covers the primary's failure and resendAllowed, it
+// calls the other backend, records that result on event and returns it if
+// it is usable; otherwise the client gets primary.
+func callFallback(w http.ResponseWriter, r *http.Request, target config.RouteTarget, event *events.ShadowEvent, useModern bool,
+	primary upstreamResult, client *http.Client, build requestBuilder, otherURL string) upstreamResult {
+
+	reason := fallbackReason(target.Fallback, primary)
+	if reason == "" {
+		return primary
+	}
+	logger := logging.From(r.Context())
+	if !resendAllowed(r, target, reason) {
+		logger.Warn("primary failed, not re-sending the write to the other backend", "reason", reason)
+		return primary
+	}
+
+	from, to := "legacy", "modern"
+	if useModern {
+		from, to = "modern", "legacy"
+	}
+	other := callBackend(r, target, client, build, to, "fallback", otherURL)
+	logUpstream(logger, to, "fallback", other)
+	if useModern {
+		event.SetLegacy(other.result())
+	} else {
+		observeModern(target, other.resp, other.err, other.duration)
+		event.SetModern(other.result())
+	}
+
+	if !other.usable() {
+		return primary
+	}
+	useFallback(w, logger, event, from, to, reason)
+	return other
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gateway/config"
+	"gateway/events"
+)
+
+func TestFallbackResendsWritesOnlyWhenOptedIn(t *testing.T) {
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer legacy.Close()
+
+	var modernCalls int32
+	modern := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&modernCalls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer modern.Close()
+
+	for _, tc := range []struct {
+		name           string
+		fallbackWrites bool
+		wantStatus     int
+		wantStates     int
+	}{
+		{"write without opt-in", false, http.StatusInternalServerError, 0},
+		{"write with opt-in", true, http.StatusOK, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sink := events.NewMemory(10)
+			target := config.RouteTarget{
+				Service:        "fallback-test",
+				Path:           "/accounts",
+				LegacyURL:      legacy.URL,
+				ModernURL:      modern.URL,
+				Weight:         1,
+				LegacyTimeout:  time.Second,
+				ModernTimeout:  time.Second,
+				Compare:        config.DefaultCompareRules(),
+				Upstream:       config.Upstream{}.WithDefaults(),
+				Fallback:       config.FallbackPolicy{config.Fallback5xx},
+				FallbackWrites: tc.fallbackWrites,
+				StateKeys:      map[string]string{"account": "account"},
+			}
+			r := httptest.NewRequest(http.MethodPost, "/fallback-test/accounts", strings.NewReader(`{"account":"42"}`))
+			w := httptest.NewRecorder()
+			HandleDynamicTransfer(w, r, target, Publishers{State: events.Publisher{Sink: sink, Topic: "state"}})
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("status %d; want %d", w.Code, tc.wantStatus)
+			}
+			if n := len(sink.Events("state", 0)); n != tc.wantStates {
+				t.Fatalf("%d state updates; want %d", n, tc.wantStates)
+			}
+		})
+	}
+}
+
+func TestFallbackNeverResendsWriteAfterTimeout(t *testing.T) {
+	var legacyCalls int32
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&legacyCalls, 1)
+	}))
+	defer legacy.Close()
+	modern := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer modern.Close()
+
+	target := config.RouteTarget{
+		Service:        "fallback-test",
+		Path:           "/accounts",
+		LegacyURL:      legacy.URL,
+		ModernURL:      modern.URL,
+		Weight:         1,
+		LegacyTimeout:  time.Second,
+		ModernTimeout:  20 * time.Millisecond,
+		Compare:        config.DefaultCompareRules(),
+		Upstream:       config.Upstream{}.WithDefaults(),
+		Fallback:       config.FallbackPolicy{config.FallbackTimeout},
+		FallbackWrites: true,
+	}
+	r := httptest.NewRequest(http.MethodPost, "/fallback-test/accounts", strings.NewReader(`{}`))
+	HandleDynamicTransfer(httptest.NewRecorder(), r, target, Publishers{})
+
+	if n := atomic.LoadInt32(&legacyCalls); n != 0 {
+		t.Fatalf("write re-sent to legacy %d times after a modern timeout", n)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	draining atomic.Bool
+
+	// Shadow calls keep running after the client has its response, so the
+	// server's own draining does not see them. shadowMu orders Add against
+	// Wait: once shadowsClosed is set no new shadow call starts.
+	shadowMu       sync.Mutex
+	shadowsClosed  bool
+	shadowCalls    sync.WaitGroup
+	shadowsRunning atomic.Int64
+)
+
+// StartDraining makes /readyz report the gateway as not ready.
+func StartDraining() {
+	draining.Store(true)
+}
+
+// WaitForShadows stops new shadow calls from starting and blocks until
+// every running one has finished and its event is sent, or ctx is done.
+func WaitForShadows(ctx context.Context) error {
+	shadowMu.Lock()
+	shadowsClosed = true
+	shadowMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		shadowCalls.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ShadowsRunning is the number of background shadow calls in flight.
+func ShadowsRunning() int64 {
+	return shadowsRunning.Load()
+}
+
+// trackShadow registers a background shadow call and returns the func
+// that marks it done. ok is false once WaitForShadows has been called; the
+// caller must then skip the shadow call.
+func trackShadow() (done func(), ok bool) {
+	shadowMu.Lock()
+	defer shadowMu.Unlock()
+	if shadowsClosed {
+		return nil, false
+	}
+	shadowCalls.Add(1)
+	shadowsRunning.Add(1)
+	return func() {
+		shadowsRunning.Add(-1)
+		shadowCalls.Done()
+	}, true
+}
+
+// ReadyHandler answers readiness probes: 200 while serving, 503 once the
+// gateway is draining for shutdown.
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	status, code := "ready", http.StatusOK
+	if draining.Load() {
+		status, code = "draining", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":          status,
+		"shadows_running": ShadowsRunning(),
+	})
+}
+
+// HealthHandler answers liveness probes; the process is up.
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTrackShadowRefusedAfterWait(t *testing.T) {
+	defer func() {
+		shadowMu.Lock()
+		shadowsClosed = false
+		shadowMu.Unlock()
+	}()
+
+	done, ok := trackShadow()
+	if !ok {
+		t.Fatal("shadow refused before shutdown")
+	}
+	waited := make(chan error, 1)
+	go func() { waited <- WaitForShadows(context.Background()) }()
+
+	// Wait must not return while a shadow runs, and no new one may start
+	// once it has been called
+	for {
+		shadowMu.Lock()
+		closed := shadowsClosed
+		shadowMu.Unlock()
+		if closed {
+			break
+		}
+	}
+	if _, ok := trackShadow(); ok {
+		t.Fatal("shadow started after WaitForShadows")
+	}
+	done()
+	if err := <-waited; err != nil {
+		t.Fatal(err)
+	}
+}
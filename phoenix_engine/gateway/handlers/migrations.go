@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"gateway/config"
+	"gateway/types"
+)
+
+// MigrationsHandler manages the migration registry:
+//
+//	GET    /admin/migrations         list all migrations
+//	POST   /admin/migrations         create a migration
+//	GET    /admin/migrations/{name}  get one migration
+//	PUT    /admin/migrations/{name}  update the given fields of a migration
+//	DELETE /admin/migrations/{name}  remove a migration
+func MigrationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/migrations"), "/")
+
+	if name == "" {
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(config.GlobalConfig.ListMigrations())
+		case http.MethodPost:
+			createMigration(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		m, ok := config.GlobalConfig.GetMigration(name)
+		if !ok {
+			http.Error(w, "Migration not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(m)
+	case http.MethodPut:
+		updateMigration(w, r, name)
+	case http.MethodDelete:
+		old, ok := config.GlobalConfig.GetMigration(name)
+		if !ok {
+			http.Error(w, "Migration not found", http.StatusNotFound)
+			return
+		}
+		if err := config.GlobalConfig.DeleteMigration(name); err != nil {
+			writeMigrationError(w, err)
+			return
+		}
+		slog.Info("migration deleted", "service", name)
+		recordChange(r, "migration-delete", name, "", old, nil, "")
+		if !persistState(w) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func createMigration(w http.ResponseWriter, r *http.Request) {
+	var req types.MigrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m := config.Migration{Name: req.Name}
+	applyMigrationRequest(&m, &req)
+
+	if err := config.GlobalConfig.CreateMigration(m); err != nil {
+		writeMigrationError(w, err)
+		return
+	}
+	slog.Info("migration created", "service", m.Name, "path_prefix", m.PathPrefix, "legacy_url", m.LegacyURL, "modern_url", m.ModernURL)
+	created, _ := config.GlobalConfig.GetMigration(m.Name)
+	recordChange(r, "migration-create", m.Name, "", nil, created, req.Reason)
+	if !persistState(w) {
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func updateMigration(w http.ResponseWriter, r *http.Request, name string) {
+	old, ok := config.GlobalConfig.GetMigration(name)
+	if !ok {
+		http.Error(w, "Migration not found", http.StatusNotFound)
+		return
+	}
+	m := old
+
+	var req types.MigrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name != "" && req.Name != name {
+		http.Error(w, "Migration name cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	applyMigrationRequest(&m, &req)
+
+	if err := config.GlobalConfig.PutMigration(m); err != nil {
+		writeMigrationError(w, err)
+		return
+	}
+	slog.Info("migration updated", "service", name)
+	updated, _ := config.GlobalConfig.GetMigration(name)
+	recordChange(r, "migration-update", name, "", old, updated, req.Reason)
+	if !persistState(w) {
+		return
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+// writeMigrationError maps a migration CRUD error to its status: 409 for a
+// taken name or a file-managed list, 404 for an unknown name, 400 otherwise.
+func writeMigrationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, config.ErrMigrationExists):
+		http.Error(w, "Migration already exists", http.StatusConflict)
+	case errors.Is(err, config.ErrFileManaged):
+		http.Error(w, "Migrations are managed by the config file; edit it and reload", http.StatusConflict)
+	case errors.Is(err, config.ErrMigrationNotFound):
+		http.Error(w, "Migration not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func applyMigrationRequest(m *config.Migration, req *types.MigrationRequest) {
+	if req.PathPrefix != nil {
+		m.PathPrefix = *req.PathPrefix
+	}
+	if req.LegacyURL != nil {
+		m.LegacyURL = *req.LegacyURL
+	}
+	if req.ModernURL != nil {
+		m.ModernURL = *req.ModernURL
+	}
+	if req.Weight != nil {
+		m.Weight = *req.Weight
+	}
+	if req.ShadowSample != nil {
+		m.ShadowSample = req.ShadowSample
+	}
+	if req.TrafficLocked != nil {
+		m.TrafficLocked = *req.TrafficLocked
+	}
+	if req.StickyKey != nil {
+		m.StickyKey = *req.StickyKey
+	}
+	if req.Routes != nil {
+		m.Routes = *req.Routes
+	}
+	if req.CircuitBreaker != nil {
+		m.CircuitBreaker = req.CircuitBreaker
+	}
+	if req.Compare != nil {
+		m.Compare = req.Compare
+	}
+	if req.HealthCheck != nil {
+		m.HealthCheck = req.HealthCheck
+	}
+	if req.Fallback != nil {
+		m.Fallback = req.Fallback
+	}
+	if req.Upstream != nil {
+		m.Upstream = req.Upstream
+	}
+}
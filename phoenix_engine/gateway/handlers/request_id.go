@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Correlation headers. A caller's ID is kept as the transaction ID,
+// forwarded to both backends and echoed on the response.
+const (
+	transactionIDHeader = "X-Transaction-Id"
+	requestIDHeader     = "X-Request-Id"
+)
+
+// maxTransactionIDLen bounds an inbound ID; anything longer is replaced.
+const maxTransactionIDLen = 128
+
+// transactionID honors an inbound X-Transaction-ID, then X-Request-ID, and
+// otherwise generates one. IDs that are too long or contain characters
+// unsafe in headers and logs are replaced with a fresh ID.
+func transactionID(r *http.Request) string {
+	for _, header := range []string{transactionIDHeader, requestIDHeader} {
+		if id := r.Header.Get(header); validTransactionID(id) {
+			return id
+		}
+	}
+	return uuid.New().String()
+}
+
+func validTransactionID(id string) bool {
+	if id == "" || len(id) > maxTransactionIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// setCorrelationHeaders puts the IDs on a forwarded request or on the
+// response: txID, and the caller's X-Request-ID if it sent a usable one,
+// otherwise txID again.
+func setCorrelationHeaders(header http.Header, r *http.Request, txID string) {
+	requestID := r.Header.Get(requestIDHeader)
+	if !validTransactionID(requestID) {
+		requestID = txID
+	}
+	header.Set(transactionIDHeader, txID)
+	header.Set(requestIDHeader, requestID)
+}
+
+// copyResponseHeaders copies a backend's headers to the client, except the
+// correlation headers the gateway already set.
+func copyResponseHeaders(w http.ResponseWriter, header http.Header) {
+	for key, values := range header {
+		if key == transactionIDHeader || key == requestIDHeader {
+			continue
+		}
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+}
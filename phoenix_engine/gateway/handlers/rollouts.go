@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"gateway/config"
+	"gateway/types"
+
+	"github.com/google/uuid"
+)
+
+// RolloutsHandler manages progressive rollout plans, which the gateway
+// executes itself (see the rollout package):
+//
+//	GET  /admin/rollouts              list all plans, newest first
+//	POST /admin/rollouts              start a plan
+//	GET  /admin/rollouts/{id}         get one plan
+//	POST /admin/rollouts/{id}/pause   stop the dwell clock
+//	POST /admin/rollouts/{id}/resume  restart the dwell clock
+//	POST /admin/rollouts/{id}/abort   stop the plan, optionally rolling back
+func RolloutsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/rollouts"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(config.GlobalConfig.ListRollouts())
+		case http.MethodPost:
+			startRollout(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ro, ok := config.GlobalConfig.GetRollout(id)
+		if !ok {
+			http.Error(w, "Rollout not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(ro)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	before, ok := config.GlobalConfig.GetRollout(id)
+	if !ok {
+		http.Error(w, "Rollout not found", http.StatusNotFound)
+		return
+	}
+
+	// The body is optional for actions
+	var req types.RolloutActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	var ro config.Rollout
+	var err error
+	switch action {
+	case "pause":
+		ro, err = config.GlobalConfig.PauseRollout(id, now)
+	case "resume":
+		ro, err = config.GlobalConfig.ResumeRollout(id, now)
+	case "abort":
+		var change *config.RolloutChange
+		ro, change, err = config.GlobalConfig.AbortRollout(id, req.Rollback, req.Reason, now)
+		if change != nil {
+			recordChange(r, "set-weight", ro.Service, ro.Route(), change.OldWeight, change.NewWeight, "rollback of rollout "+ro.ID)
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	slog.Info("rollout state changed", "rollout", ro.ID, "service", ro.Service, "route", ro.Route(), "from", before.State, "to", ro.State)
+	recordChange(r, "rollout-"+action, ro.Service, ro.Route(), before.State, ro.State, req.Reason)
+	if !persistState(w) {
+		return
+	}
+	json.NewEncoder(w).Encode(ro)
+}
+
+func startRollout(w http.ResponseWriter, r *http.Request) {
+	var req types.RolloutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	steps := req.Steps
+	if len(steps) == 0 {
+		for _, weight := range req.Weights {
+			steps = append(steps, config.RolloutStep{Weight: weight})
+		}
+	} else if len(req.Weights) > 0 {
+		http.Error(w, "Give either weights or steps, not both", http.StatusBadRequest)
+		return
+	}
+
+	change, err := config.GlobalConfig.StartRollout(config.Rollout{
+		ID:        uuid.New().String(),
+		Service:   req.Service,
+		Method:    req.Method,
+		Path:      req.Path,
+		Steps:     steps,
+		MinDwell:  req.MinDwell,
+		CreatedBy: requestActor(r),
+	}, time.Now().UTC())
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, config.ErrRolloutActive) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	ro := change.Rollout
+	slog.Info("rollout started", "rollout", ro.ID, "service", ro.Service, "route", ro.Route(),
+		"steps", len(ro.Steps), "old_weight", change.OldWeight, "new_weight", change.NewWeight)
+	recordChange(r, "rollout-start", ro.Service, ro.Route(), change.OldWeight, change.NewWeight, req.Reason)
+	if !persistState(w) {
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ro)
+}
+
+// rolloutStatus summarises the active plans for a service in /admin/status.
+func rolloutStatus(rollouts []config.Rollout, service string) []map[string]interface{} {
+	status := []map[string]interface{}{}
+	for _, ro := range rollouts {
+		if ro.Service != service || !ro.Active() {
+			continue
+		}
+		entry := map[string]interface{}{
+			"id":           ro.ID,
+			"route":        ro.Route(),
+			"state":        ro.State,
+			"current_step": ro.CurrentStep + 1,
+			"total_steps":  len(ro.Steps),
+			"step_weight":  ro.Steps[ro.CurrentStep].Weight,
+		}
+		if next := ro.NextStepAt(); !next.IsZero() {
+			entry["next_step_at"] = next
+			entry["next_weight"] = ro.Steps[ro.CurrentStep+1].Weight
+		}
+		status = append(status, entry)
+	}
+	return status
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"gateway/config"
+	"gateway/events"
+	"gateway/logging"
+	"gateway/tracing"
+)
+
+// statusClientClosedRequest is logged and counted when the client hung up
+// before the backend answered; nobody reads the response.
+const statusClientClosedRequest = 499
+
+// upstreamContext bounds a call to backend that the client waits for by
+// the backend's deadline and labels it for tracing. The call is canceled
+// when the client goes away.
+func upstreamContext(r *http.Request, target config.RouteTarget, backend, role string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(r.Context(), target.TimeoutFor(backend))
+	return tracing.WithUpstream(ctx, backend, role), cancel
+}
+
+// shadowContext bounds the background shadow call to backend. It keeps the
+// request's trace but not its cancellation, so a client that already has
+// its answer does not cut the comparison short.
+func shadowContext(r *http.Request, target config.RouteTarget, backend string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(tracing.Detach(r.Context()), target.ShadowTimeoutFor(backend))
+	return tracing.WithUpstream(ctx, backend, "shadow"), cancel
+}
+
+// shadowDebugHeader asks for the combined {mode, legacy, modern} wrapper
+// instead of the primary's own response. Setting it makes the client wait
+// for both backends.
+const shadowDebugHeader = "X-Shadow-Debug"
+
+// shouldShadow samples whether this request is mirrored to the backend that
+// is not primary.
+func shouldShadow(target config.RouteTarget) bool {
+	return rand.Float64() < target.ShadowSample
+}
+
+// requestBuilder creates the upstream request for one backend URL.
+type requestBuilder func(ctx context.Context, url string) (*http.Request, error)
+
+// upstreamResult is one backend's answer with the body already read.
+type upstreamResult struct {
+	resp     *http.Response // nil when the call failed
+	body     []byte
+	err      error
+	duration time.Duration
+}
+
+func callUpstream(ctx context.Context, client *http.Client, build requestBuilder, url string) upstreamResult {
+	start := time.Now()
+	req, err := build(ctx, url)
+	if err != nil {
+		return upstreamResult{err: err}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return upstreamResult{err: err, duration: time.Since(start)}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return upstreamResult{err: err, duration: time.Since(start)}
+	}
+	return upstreamResult{resp: resp, body: body, duration: time.Since(start)}
+}
+
+// callBackend calls backend on behalf of a client that waits for the answer.
+func callBackend(r *http.Request, target config.RouteTarget, client *http.Client, build requestBuilder, backend, role, url string) upstreamResult {
+	ctx, cancel := upstreamContext(r, target, backend, role)
+	defer cancel()
+	return callUpstream(ctx, client, build, url)
+}
+
+// failUpstream answers the client after the call that should have answered
+// it failed: 504 when the deadline passed, status with msg otherwise.
+func failUpstream(w http.ResponseWriter, res upstreamResult, status int, msg string) {
+	switch events.ClassifyError(res.err) {
+	case events.ErrorTimeout:
+		http.Error(w, "Gateway timeout", http.StatusGatewayTimeout)
+	case events.ErrorCanceled:
+		w.WriteHeader(statusClientClosedRequest)
+	default:
+		http.Error(w, msg, status)
+	}
+}
+
+func (res upstreamResult) result() events.BackendResult {
+	status := 0
+	if res.resp != nil {
+		status = res.resp.StatusCode
+	}
+	return events.NewBackendResult(status, res.body, res.err, res.duration)
+}
+
+// logUpstream records one backend call. The response body is only logged
+// at debug level, redacted.
+func logUpstream(logger *slog.Logger, backend, role string, res upstreamResult) {
+	if res.err != nil {
+		logger.Error("upstream failed", "backend", backend, "role", role,
+			"duration_ms", float64(res.duration.Microseconds())/1000, "error_class", events.ClassifyError(res.err), "error", res.err)
+		return
+	}
+	logger.Info("upstream responded", "backend", backend, "role", role,
+		"status", res.resp.StatusCode, "duration_ms", float64(res.duration.Microseconds())/1000)
+	logging.DebugBody(logger, "upstream response body", res.body, "backend", backend)
+}
+
+// requestLogger tags every log line of the request, and its access-log line,
+// with the transaction ID, service, route and trace.
+func requestLogger(r *http.Request, target config.RouteTarget, txID string) (*http.Request, *slog.Logger) {
+	args := []any{"transaction_id", txID, "service", target.Service, "route", target.Route}
+	if traceID := tracing.TraceID(r.Context()); traceID != "" {
+		args = append(args, "trace_id", traceID)
+	}
+	ctx, logger := logging.With(r.Context(), args...)
+	return r.WithContext(ctx), logger
+}
+
+// serveShadowed sends a request to both backends. The client gets the
+// primary's exact status, headers and body as soon as it arrives; the shadow
+// call finishes in the background under its shadow deadline and its result
+// only goes into the comparison event, unless the primary failed and
+// target.Fallback lets the shadow's answer stand in.
+func serveShadowed(w http.ResponseWriter, r *http.Request, target config.RouteTarget, event *events.ShadowEvent, useModern bool,
+	client *http.Client, build requestBuilder, legacyURL, modernURL string, send func(*events.ShadowEvent)) {
+
+	event.Mode = events.ModeShadowing
+	event.SetPrimary(useModern)
+	tracing.RecordShadowEvent(r.Context(), event)
+
+	if r.Header.Get(shadowDebugHeader) != "" {
+		serveShadowDebug(w, r, target, event, useModern, client, build, legacyURL, modernURL, send)
+		return
+	}
+
+	logger := logging.From(r.Context())
+	primaryName, primaryURL, shadowName, shadowURL := "legacy", legacyURL, "modern", modernURL
+	if useModern {
+		primaryName, primaryURL, shadowName, shadowURL = "modern", modernURL, "legacy", legacyURL
+	}
+
+	shadowDone, ok := trackShadow()
+	if !ok {
+		logger.Warn("gateway is shutting down, skipping shadow call", "shadow", shadowName)
+		servePrimaryOnly(w, r, target, event, useModern, client, build, primaryURL, send)
+		return
+	}
+
+	primaryDone := make(chan upstreamResult, 1)
+	shadowResult := make(chan upstreamResult, 1)
+	go func() {
+		defer shadowDone()
+		ctx, cancel := shadowContext(r, target, shadowName)
+		defer cancel()
+
+		shadow := callUpstream(ctx, client, build, shadowURL)
+		logUpstream(logger, shadowName, "shadow", shadow)
+		shadowResult <- shadow
+
+		primary := <-primaryDone
+		if useModern {
+			emitShadowEvent(logger, target, event, shadow, primary, send)
+		} else {
+			emitShadowEvent(logger, target, event, primary, shadow, send)
+		}
+	}()
+
+	primary := callBackend(r, target, client, build, primaryName, "primary", primaryURL)
+	logUpstream(logger, primaryName, "primary", primary)
+
+	// When the fallback policy covers the primary's failure the client waits
+	// for the shadow call, which already carries the same request, and gets
+	// its answer instead. The event is only sent once primaryDone has the
+	// primary's result, so the fallback is tagged before that.
+	served := primary
+	if reason := fallbackReason(target.Fallback, primary); reason != "" {
+		if shadow := <-shadowResult; shadow.usable() {
+			useFallback(w, logger, event, primaryName, shadowName, reason)
+			served = shadow
+		}
+	}
+	primaryDone <- primary
+
+	if served.err != nil {
+		failUpstream(w, served, http.StatusServiceUnavailable, "Service unavailable")
+		return
+	}
+	copyResponseHeaders(w, served.resp.Header)
+	w.WriteHeader(served.resp.StatusCode)
+	w.Write(served.body)
+
+	logger.Debug("returned primary response, shadow continues in background", "primary", primaryName)
+}
+
+// servePrimaryOnly answers a shadowed request from its primary alone, for
+// when the shadow call cannot be started any more.
+func servePrimaryOnly(w http.ResponseWriter, r *http.Request, target config.RouteTarget, event *events.ShadowEvent, useModern bool,
+	client *http.Client, build requestBuilder, primaryURL string, send func(*events.ShadowEvent)) {
+
+	logger := logging.From(r.Context())
+	primaryName := "legacy"
+	if useModern {
+		primaryName = "modern"
+	}
+	primary := callBackend(r, target, client, build, primaryName, "primary", primaryURL)
+	logUpstream(logger, primaryName, "primary", primary)
+
+	event.Mode = events.ModeShadowingLegacyOnly
+	if useModern {
+		observeModern(target, primary.resp, primary.err, primary.duration)
+		event.SetModern(primary.result())
+		event.Mode = events.ModeShadowingModernOnly
+	} else {
+		event.SetLegacy(primary.result())
+	}
+
+	if primary.err == nil {
+		copyResponseHeaders(w, primary.resp.Header)
+		w.WriteHeader(primary.resp.StatusCode)
+		w.Write(primary.body)
+	} else {
+		failUpstream(w, primary, http.StatusServiceUnavailable, "Service unavailable")
+	}
+	send(event)
+}
+
+// serveShadowDebug waits for both backends and returns the combined wrapper.
+func serveShadowDebug(w http.ResponseWriter, r *http.Request, target config.RouteTarget, event *events.ShadowEvent, useModern bool,
+	client *http.Client, build requestBuilder, legacyURL, modernURL string, send func(*events.ShadowEvent)) {
+
+	logger := logging.From(r.Context())
+	legacyRole, modernRole := "primary", "shadow"
+	if useModern {
+		legacyRole, modernRole = "shadow", "primary"
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	var legacy, modern upstreamResult
+	go func() {
+		defer wg.Done()
+		legacy = callBackend(r, target, client, build, "legacy", legacyRole, legacyURL)
+		logUpstream(logger, "legacy", legacyRole, legacy)
+	}()
+	go func() {
+		defer wg.Done()
+		modern = callBackend(r, target, client, build, "modern", modernRole, modernURL)
+		logUpstream(logger, "modern", modernRole, modern)
+	}()
+	wg.Wait()
+
+	emitShadowEvent(logger, target, event, legacy, modern, send)
+
+	combinedResponse := map[string]interface{}{
+		"mode":           "shadowing",
+		"transaction_id": event.TransactionID,
+		"weight":         target.Weight,
+		"primary_target": event.PrimaryTarget,
+		"match":          event.Match,
+		"legacy":         debugSummary(legacy, !useModern),
+		"modern":         debugSummary(modern, useModern),
+	}
+
+	responseBytes, _ := json.Marshal(combinedResponse)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBytes)
+
+	logger.Debug("returned both responses", "primary", event.PrimaryTarget)
+}
+
+func debugSummary(res upstreamResult, isPrimary bool) map[string]interface{} {
+	summary := map[string]interface{}{
+		"status":     0,
+		"latency_ms": res.duration.Milliseconds(),
+		"response":   nil,
+		"is_primary": isPrimary,
+	}
+	if res.err != nil {
+		summary["error"] = res.err.Error()
+		return summary
+	}
+
+	var body interface{}
+	json.Unmarshal(res.body, &body)
+	summary["status"] = res.resp.StatusCode
+	summary["response"] = body
+	return summary
+}
+
+// emitShadowEvent feeds modern's outcome to the circuit breaker, completes
+// the event for a shadowed request with both results and the comparison,
+// and sends it.
+func emitShadowEvent(logger *slog.Logger, target config.RouteTarget, event *events.ShadowEvent, legacy, modern upstreamResult, send func(*events.ShadowEvent)) {
+	observeModern(target, modern.resp, modern.err, modern.duration)
+
+	event.SetLegacy(legacy.result())
+	event.SetModern(modern.result())
+
+	addComparison(event, target, legacy.resp, legacy.body, modern.resp, modern.body)
+	send(event)
+	// Match is a pointer so the JSON can omit it; a nil one counts as no match
+	// rather than panicking in the shadow goroutine
+	logger.Info("sent comparison event", "primary", event.PrimaryTarget, "match", event.Match != nil && *event.Match)
+}
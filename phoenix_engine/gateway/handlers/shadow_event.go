@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"gateway/config"
+	"gateway/events"
+	"gateway/tracing"
+)
+
+// newShadowEvent starts the event for one proxied request with the fields
+// every mode carries. Callers fill in the mode and backend results.
+func newShadowEvent(target config.RouteTarget, r *http.Request, txID string, bodyBytes []byte) *events.ShadowEvent {
+	event := events.NewShadowEvent(txID)
+	event.TraceID = tracing.TraceID(r.Context())
+	event.ServiceType = target.Service
+	event.Route = target.Route
+	event.Method = r.Method
+	event.Path = r.URL.Path
+	event.AccountKey = accountKey(target, r, bodyBytes)
+	event.ClientIP = clientIP(r)
+	event.RequestHash = events.HashBody(bodyBytes)
+	event.Weight = target.Weight
+	event.ShadowSample = target.ShadowSample
+	return event
+}
+
+// eventMode maps the mode a client asked for to the mode events report.
+func eventMode(mode string) string {
+	switch mode {
+	case "legacy":
+		return events.ModeLegacyOnly
+	case "modern":
+		return events.ModeModernOnly
+	}
+	return events.ModeShadowing
+}
+
+// accountKey identifies the customer: the route's sticky key when the
+// request carries it, otherwise the body's account_number.
+func accountKey(target config.RouteTarget, r *http.Request, bodyBytes []byte) string {
+	if key := stickyKeyValue(target.StickyKey, r, bodyBytes); key != "" {
+		return key
+	}
+	return jsonField(bodyBytes, "account_number")
+}
+
+// clientIP is the first X-Forwarded-For hop when the gateway sits behind a
+// proxy, otherwise the peer address.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
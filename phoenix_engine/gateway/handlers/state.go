@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"gateway/config"
+	"gateway/events"
+)
+
+// transferStateKeys are published for <prefix>/transfer when its route does
+// not configure state_keys.
+var transferStateKeys = map[string]string{"account_number": "account_number"}
+
+// publishStateUpdate sends a db-state-updates event once both backends
+// answered a write, whether shadowed or re-sent by a fallback. The keys come from the route's state_keys, or
+// from defaults when it has none; nothing is sent when the body carries
+// none of them.
+func publishStateUpdate(logger *slog.Logger, stateEvents events.Publisher, target config.RouteTarget, event *events.ShadowEvent, bodyBytes []byte, defaults map[string]string) {
+	if event.LegacyStatus == 0 || event.ModernStatus == 0 || !isWrite(event.Method) {
+		return
+	}
+
+	spec := target.StateKeys
+	if len(spec) == 0 {
+		spec = defaults
+	}
+	keys := map[string]string{}
+	for name, path := range spec {
+		if value := jsonField(bodyBytes, path); value != "" {
+			keys[name] = value
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := stateEvents.Publish(events.NewStateEvent(event, keys)); err != nil {
+		logger.Error("failed to send state update", "error", err)
+		return
+	}
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	logger.Info("sent state update", "keys", names)
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
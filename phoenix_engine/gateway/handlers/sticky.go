@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strings"
+
+	"gateway/config"
+)
+
+// stickyBuckets is the number of buckets sticky keys are hashed into. A
+// bucket is routed to modern when it falls below weight * stickyBuckets, so
+// raising the weight only ever adds buckets to modern.
+const stickyBuckets = 10000
+
+// choosePrimary decides whether modern answers this request. When the route
+// has a sticky key and the request carries it, the decision is a pure
+// function of the key; otherwise it falls back to a random roll. The bucket
+// is -1 when no sticky key was used.
+func choosePrimary(target config.RouteTarget, r *http.Request, bodyBytes []byte) (useModern bool, bucket int) {
+	key := stickyKeyValue(target.StickyKey, r, bodyBytes)
+	if key == "" {
+		return rand.Float64() < target.Weight, -1
+	}
+
+	// Compared as floats: truncating 0.57*stickyBuckets (5699.999...) to an
+	// int would leave bucket 5699 on legacy
+	bucket = stickyBucket(target.Service, key)
+	return float64(bucket) < target.Weight*stickyBuckets, bucket
+}
+
+// stickyBucket hashes key into [0, stickyBuckets). The service name is mixed
+// in so each migration ramps a different slice of customers.
+func stickyBucket(service, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(service))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int(h.Sum32() % stickyBuckets)
+}
+
+// stickyKeyValue extracts the configured sticky key from the request, or ""
+// if the route has no sticky key or the request does not carry it.
+func stickyKeyValue(spec string, r *http.Request, bodyBytes []byte) string {
+	if spec == "" {
+		return ""
+	}
+	source, name, err := config.ParseStickyKey(spec)
+	if err != nil {
+		return ""
+	}
+
+	switch source {
+	case config.StickyFromHeader:
+		return r.Header.Get(name)
+	case config.StickyFromCookie:
+		if c, err := r.Cookie(name); err == nil {
+			return c.Value
+		}
+	case config.StickyFromBody:
+		return jsonField(bodyBytes, name)
+	}
+	return ""
+}
+
+// jsonField returns the value at a dotted path in a JSON object body,
+// formatted as a string, or "" if it is missing.
+func jsonField(bodyBytes []byte, path string) string {
+	if len(bodyBytes) == 0 {
+		return ""
+	}
+
+	// UseNumber keeps account numbers exactly as the client sent them
+	decoder := json.NewDecoder(bytes.NewReader(bodyBytes))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return ""
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if value, ok = obj[part]; !ok {
+			return ""
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
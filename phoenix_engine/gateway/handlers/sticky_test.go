@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"gateway/config"
+)
+
+// keyInBucket finds an account number that service hashes into bucket.
+func keyInBucket(t *testing.T, service string, bucket int) string {
+	for i := 0; i < 1000000; i++ {
+		key := fmt.Sprintf("ACC-%d", i)
+		if stickyBucket(service, key) == bucket {
+			return key
+		}
+	}
+	t.Fatalf("no key hashes into bucket %d", bucket)
+	return ""
+}
+
+func TestChoosePrimaryWeightBoundary(t *testing.T) {
+	// 0.57*stickyBuckets is 5699.999... in floating point, 0.29 lands exactly
+	for _, tc := range []struct {
+		weight float64
+		bucket int
+		modern bool
+	}{
+		{0.29, 2899, true},
+		{0.29, 2900, false},
+		{0.57, 5698, true},
+		{0.57, 5699, true},
+		{0.57, 5700, false},
+	} {
+		target := config.RouteTarget{Service: "php", Weight: tc.weight, StickyKey: "body:account_number"}
+		body := []byte(fmt.Sprintf(`{"account_number":%q}`, keyInBucket(t, target.Service, tc.bucket)))
+		useModern, bucket := choosePrimary(target, httptest.NewRequest("POST", "/php/transfer", nil), body)
+		if bucket != tc.bucket || useModern != tc.modern {
+			t.Errorf("weight %.2f, bucket %d: modern %v; want bucket %d modern %v", tc.weight, bucket, useModern, tc.bucket, tc.modern)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+func TestDynamicTransferDropsClientAcceptEncoding(t *testing.T) {
+	var received string
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(received, "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(`{"ok":true}`))
+			gz.Close()
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer legacy.Close()
+
+	target := config.RouteTarget{
+		Service:       "encoding-test",
+		Path:          "/accounts",
+		LegacyURL:     legacy.URL,
+		ModernURL:     legacy.URL,
+		LegacyTimeout: time.Second,
+		ModernTimeout: time.Second,
+		Compare:       config.DefaultCompareRules(),
+		Upstream:      config.Upstream{}.WithDefaults(),
+	}
+	r := httptest.NewRequest(http.MethodGet, "/encoding-test/accounts?mode=legacy", nil)
+	r.Header.Set("Accept-Encoding", "br")
+	w := httptest.NewRecorder()
+	HandleDynamicTransfer(w, r, target, Publishers{})
+
+	if received == "br" {
+		t.Fatal("client Accept-Encoding was forwarded upstream")
+	}
+	if got := w.Body.String(); got != `{"ok":true}` {
+		t.Fatalf("body %q; want the decoded JSON", got)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("Content-Encoding %q on a decoded body", got)
+	}
+}
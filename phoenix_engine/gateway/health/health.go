@@ -0,0 +1,212 @@
+// Package health probes the legacy and modern backend of every migration
+// that configures a health check, so routing can fail over before a real
+// customer request hits a backend that is down.
+package health
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gateway/audit"
+	"gateway/config"
+)
+
+// Backends probed for every migration.
+var Backends = []string{"legacy", "modern"}
+
+// Status is one backend's health as reported by the admin API.
+type Status struct {
+	Service              string     `json:"service"`
+	Backend              string     `json:"backend"`
+	URL                  string     `json:"url"`
+	Healthy              bool       `json:"healthy"`
+	Since                *time.Time `json:"since,omitempty"` // When the backend entered its current state
+	LastCheck            *time.Time `json:"last_check,omitempty"`
+	LastStatus           int        `json:"last_status,omitempty"`
+	LastError            string     `json:"last_error,omitempty"`
+	ConsecutiveFailures  int        `json:"consecutive_failures"`
+	ConsecutiveSuccesses int        `json:"consecutive_successes"`
+}
+
+type key struct {
+	service string
+	backend string
+}
+
+type backend struct {
+	status  Status
+	probing bool
+	nextAt  time.Time
+}
+
+// Registry holds the probe state of all backends.
+type Registry struct {
+	mu       sync.Mutex
+	backends map[key]*backend
+	client   *http.Client
+}
+
+var Global = &Registry{
+	backends: map[key]*backend{},
+	client:   &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }},
+}
+
+// Healthy reports whether the backend may receive traffic. Backends without
+// a health check, or not probed yet, count as healthy.
+func (reg *Registry) Healthy(service, name string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	b, ok := reg.backends[key{service, name}]
+	return !ok || b.status.Healthy
+}
+
+// Run starts due probes every interval until the process exits.
+func (reg *Registry) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		reg.probeDue(config.GlobalConfig.ListMigrations(), now)
+	}
+}
+
+// probeDue starts a probe for every backend whose interval has passed and
+// forgets backends whose migration no longer has a health check.
+func (reg *Registry) probeDue(migrations []config.Migration, now time.Time) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	configured := map[key]bool{}
+	for _, m := range migrations {
+		if m.HealthCheck == nil {
+			continue
+		}
+		settings := m.HealthCheck.WithDefaults()
+		urls := map[string]string{"legacy": m.LegacyURL, "modern": m.ModernURL}
+		for _, name := range Backends {
+			k := key{m.Name, name}
+			configured[k] = true
+			url := urls[name] + settings.PathFor(name)
+
+			b, ok := reg.backends[k]
+			if !ok || b.status.URL != url {
+				// A new URL is a different server; start from healthy again
+				b = &backend{status: Status{Service: m.Name, Backend: name, URL: url, Healthy: true}}
+				reg.backends[k] = b
+			}
+			if b.probing || now.Before(b.nextAt) {
+				continue
+			}
+			b.probing = true
+			b.nextAt = now.Add(time.Duration(settings.Interval))
+			go reg.probe(k, url, settings)
+		}
+	}
+	for k := range reg.backends {
+		if !configured[k] {
+			delete(reg.backends, k)
+		}
+	}
+}
+
+func (reg *Registry) probe(k key, url string, settings config.HealthCheck) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(settings.Timeout))
+	defer cancel()
+
+	status := 0
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = reg.client.Do(req)
+		if err == nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			status = resp.StatusCode
+		}
+	}
+	reg.record(k, url, settings, status, err, time.Now().UTC())
+}
+
+// record applies one probe result and reports state changes.
+func (reg *Registry) record(k key, url string, settings config.HealthCheck, status int, err error, now time.Time) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	b, ok := reg.backends[k]
+	if !ok || b.status.URL != url {
+		// Health check removed or URL changed while probing
+		return
+	}
+	b.probing = false
+
+	s := &b.status
+	s.LastCheck = &now
+	s.LastStatus = status
+	s.LastError = ""
+	passed := err == nil && status >= 200 && status < 400
+	switch {
+	case err != nil:
+		s.LastError = err.Error()
+	case !passed:
+		s.LastError = http.StatusText(status)
+	}
+
+	if passed {
+		s.ConsecutiveSuccesses++
+		s.ConsecutiveFailures = 0
+		if !s.Healthy && s.ConsecutiveSuccesses >= settings.HealthyThreshold {
+			s.Healthy = true
+			s.Since = &now
+			slog.Info("backend healthy again", "service", k.service, "backend", k.backend, "successes", s.ConsecutiveSuccesses)
+			record(k, "unhealthy", "healthy", "")
+		}
+		return
+	}
+
+	s.ConsecutiveFailures++
+	s.ConsecutiveSuccesses = 0
+	if s.Healthy && s.ConsecutiveFailures >= settings.UnhealthyThreshold {
+		s.Healthy = false
+		s.Since = &now
+		slog.Warn("backend unhealthy", "service", k.service, "backend", k.backend, "failures", s.ConsecutiveFailures, "error", s.LastError)
+		record(k, "healthy", "unhealthy", s.LastError)
+	}
+}
+
+// Status reports every probed backend, sorted by service and backend.
+func (reg *Registry) Status() []Status {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	list := make([]Status, 0, len(reg.backends))
+	for _, b := range reg.backends {
+		list = append(list, b.status)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Service != list[j].Service {
+			return list[i].Service < list[j].Service
+		}
+		return list[i].Backend < list[j].Backend
+	})
+	return list
+}
+
+// record writes a health transition to the audit log, which also publishes
+// it to the audit topic.
+func record(k key, from, to, reason string) {
+	audit.GlobalLog.Record(audit.Entry{
+		Actor:    "health-check:" + k.backend,
+		Action:   "backend-" + to,
+		Service:  k.service,
+		OldValue: from,
+		NewValue: to,
+		Reason:   reason,
+	})
+}
@@ -0,0 +1,89 @@
+// Package logging sets up the gateway's structured logger and carries a
+// per-request logger, tagged with the transaction ID, service and route,
+// through the request context.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"gateway/config"
+)
+
+// FromConfig installs the default slog logger. Lines still written with
+// the standard log package go through it at info level.
+func FromConfig(cfg config.LoggingFile) {
+	level := slog.LevelInfo
+	switch strings.ToLower(cfg.Level) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler = slog.NewJSONHandler(os.Stderr, opts)
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	setRedactFields(cfg.RedactFields)
+}
+
+type contextKey struct{}
+
+// request is shared between the access-log middleware and the handler, so
+// attributes the handler learns, such as the transaction ID, end up on the
+// access-log line too.
+type request struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	attrs  []any
+}
+
+// WithRequest prepares ctx for one request. The access-log middleware calls
+// it before running the handler.
+func WithRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, &request{logger: slog.Default()})
+}
+
+// With adds key/value pairs to the request's logger and access-log line.
+// Outside a request it returns a context whose logger carries args.
+func With(ctx context.Context, args ...any) (context.Context, *slog.Logger) {
+	req, ok := ctx.Value(contextKey{}).(*request)
+	if !ok {
+		req = &request{logger: slog.Default()}
+		ctx = context.WithValue(ctx, contextKey{}, req)
+	}
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	req.logger = req.logger.With(args...)
+	req.attrs = append(req.attrs, args...)
+	return ctx, req.logger
+}
+
+// From returns the request's logger, or the default logger.
+func From(ctx context.Context) *slog.Logger {
+	if req, ok := ctx.Value(contextKey{}).(*request); ok {
+		req.mu.Lock()
+		defer req.mu.Unlock()
+		return req.logger
+	}
+	return slog.Default()
+}
+
+// Attrs returns the key/value pairs added with With during the request.
+func Attrs(ctx context.Context) []any {
+	if req, ok := ctx.Value(contextKey{}).(*request); ok {
+		req.mu.Lock()
+		defer req.mu.Unlock()
+		return append([]any(nil), req.attrs...)
+	}
+	return nil
+}
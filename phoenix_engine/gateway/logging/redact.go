@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"gateway/config"
+)
+
+const redacted = "[REDACTED]"
+
+// redactFields is set once at startup, before any request is served.
+var redactFields = fieldSet(config.DefaultRedactFields)
+
+func setRedactFields(fields []string) {
+	redactFields = fieldSet(fields)
+}
+
+func fieldSet(fields []string) map[string]bool {
+	set := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		set[strings.ToLower(f)] = true
+	}
+	return set
+}
+
+// Redact returns body for logging with the values of the redacted fields
+// masked. A body that is not JSON cannot be redacted and is only described
+// by its size.
+func Redact(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Sprintf("<%d bytes, not JSON>", len(body))
+	}
+	out, err := json.Marshal(redact(value))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+	return string(out)
+}
+
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redactFields[strings.ToLower(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = redact(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item)
+		}
+	}
+	return value
+}
+
+// DebugBody logs body at debug level, redacted. Nothing is parsed unless
+// debug logging is on.
+func DebugBody(logger *slog.Logger, msg string, body []byte, args ...any) {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	logger.Debug(msg, append(args, "body", Redact(body))...)
+}
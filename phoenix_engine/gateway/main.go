@@ -1,37 +1,239 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"gateway/audit"
+	"gateway/auth"
+	"gateway/breaker"
+	"gateway/config"
+	"gateway/events"
+	"gateway/handlers"
+	"gateway/health"
+	"gateway/logging"
+	"gateway/metrics"
+	"gateway/rollout"
 	"gateway/router"
-	"gateway/services"
+	"gateway/store"
+	"gateway/tracing"
 )
 
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
-	// Initialize Kafka Service
-	kafkaService, err := services.NewKafkaService(
-		os.Getenv("KAFKA_BOOTSTRAP_SERVERS"),
-		"shadow-requests",
-	)
-	
+	// Load the gateway config file, or fall back to the environment defaults
+	gatewayConfig := config.DefaultFileConfig()
+	configPath := os.Getenv("GATEWAY_CONFIG")
+	if configPath != "" {
+		var err error
+		gatewayConfig, err = config.LoadFile(configPath)
+		if err != nil {
+			log.Fatalf("Invalid gateway config: %s", err)
+		}
+		log.Printf("Loaded gateway config from %s", configPath)
+	} else if err := gatewayConfig.Validate(); err != nil {
+		log.Fatalf("Invalid gateway config from environment: %s", err)
+	}
+	config.GlobalConfig.ApplyFile(configPath, gatewayConfig)
+
+	// Structured logs from here on; the log package goes through the same handler
+	logging.FromConfig(gatewayConfig.Logging)
+
+	// Event sinks: Kafka, file, stdout, webhook and memory, as configured
+	eventSinks, err := events.FromConfig(gatewayConfig.Events)
+	if err != nil {
+		log.Fatalf("Failed to open event sinks: %s", err)
+	}
+	publishers := handlers.Publishers{
+		Shadow:   events.Publisher{Sink: eventSinks.All, Topic: gatewayConfig.Events.Kafka.Topic},
+		State:    events.Publisher{Topic: gatewayConfig.Events.Kafka.StateTopic},
+		Failover: events.Publisher{Topic: gatewayConfig.Events.Kafka.FailoverTopic},
+	}
+	if publishers.State.Topic != "" {
+		publishers.State.Sink = eventSinks.All
+	}
+	if publishers.Failover.Topic != "" {
+		publishers.Failover.Sink = eventSinks.All
+	}
+
+	// Routing state, breakers and sink counters are read on every scrape
+	metrics.Register(eventSinks)
+
+	// OpenTelemetry spans for proxied requests and their upstream calls
+	shutdownTracing, err := tracing.FromConfig(gatewayConfig.Tracing)
 	if err != nil {
-		log.Printf("Failed to create Kafka service: %s", err)
-	} else {
-		defer kafkaService.Close()
-		log.Println("Kafka service initialized successfully")
+		log.Fatalf("Failed to start tracing: %s", err)
+	}
+
+	// Audit trail for admin changes
+	if gatewayConfig.AuditLog != "" {
+		if err := audit.GlobalLog.Open(gatewayConfig.AuditLog); err != nil {
+			log.Fatalf("Failed to open audit log: %s", err)
+		}
+	}
+	if gatewayConfig.Events.Kafka.AuditTopic != "" {
+		auditTopic := gatewayConfig.Events.Kafka.AuditTopic
+		audit.GlobalLog.Publish = func(data []byte) {
+			if err := eventSinks.All.Send(auditTopic, data); err != nil {
+				log.Printf("Failed to publish audit entry: %s", err)
+			}
+		}
+	}
+
+	// Restore weights and locks saved before the last restart
+	if gatewayConfig.StateStore != "" {
+		restoreState(gatewayConfig.StateStore)
+	}
+
+	// A tripped circuit breaker stops any rollout still ramping the service
+	breaker.Global.OnOpen = func(service, reason string) {
+		rollout.AbortFor(service, "circuit breaker opened: "+reason)
+	}
+
+	// Execute progressive rollout plans, including ones restored above
+	go rollout.Run(time.Second)
+
+	// Probe backends with a health check so routing can fail over
+	go health.Global.Run(time.Second)
+
+	// Hot reload on SIGHUP or when the file changes
+	if configPath != "" {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		go config.GlobalConfig.WatchFile(gatewayConfig, 2*time.Second, reload)
+	}
+
+	// Admin API authentication
+	authenticator := auth.FromConfig(gatewayConfig.AdminAuth)
+	if authenticator == nil {
+		slog.Warn("admin endpoints are not authenticated; configure admin_auth or GATEWAY_ADMIN_TOKENS")
 	}
 
 	// Setup routes
-	router.SetupRoutes(kafkaService)
+	router.SetupRoutes(publishers, eventSinks, authenticator)
 
 	// Start server
-	port := ":8082"
-	log.Printf("Gateway listening on %s", port)
-	log.Fatal(http.ListenAndServe(port, nil))
+	server := &http.Server{Addr: gatewayConfig.Listen}
+	if gatewayConfig.TLS.ClientCAFile != "" {
+		tlsConfig, err := clientCertTLSConfig(gatewayConfig.TLS.ClientCAFile)
+		if err != nil {
+			log.Fatalf("Failed to load client CA: %s", err)
+		}
+		server.TLSConfig = tlsConfig
+	}
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if gatewayConfig.TLS.CertFile != "" {
+			log.Printf("Gateway listening on %s (TLS)", gatewayConfig.Listen)
+			serveErr <- server.ListenAndServeTLS(gatewayConfig.TLS.CertFile, gatewayConfig.TLS.KeyFile)
+			return
+		}
+		log.Printf("Gateway listening on %s", gatewayConfig.Listen)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case sig := <-shutdown:
+		log.Printf("%s received, draining", sig)
+	}
+
+	drain(server, gatewayConfig.Shutdown)
+
+	// Flush queued events and spans; what Kafka does not take in time stays
+	// in the outbox for the next start. drain has returned, so no new shadow
+	// call starts and the running ones are done or abandoned.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush spans: %s", err)
+	}
+	cancel()
+	if err := eventSinks.All.Close(); err != nil {
+		log.Printf("Failed to close event sinks: %s", err)
+	}
+	if err := audit.GlobalLog.Close(); err != nil {
+		log.Printf("Failed to close audit log: %s", err)
+	}
+	log.Printf("Gateway stopped")
+}
+
+// drain takes the gateway out of rotation and lets work in flight finish:
+// /readyz fails for DrainDelay while requests are still served, then the
+// listener closes and requests and background shadow calls get the rest of
+// Timeout. Whatever is still running after that is abandoned.
+func drain(server *http.Server, settings config.ShutdownFile) {
+	handlers.StartDraining()
+	if settings.DrainDelay > 0 {
+		log.Printf("Readiness set to draining, waiting %s before closing the listener", settings.DrainDelay)
+		time.Sleep(time.Duration(settings.DrainDelay))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(settings.Timeout))
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Requests still in flight after %s: %s", settings.Timeout, err)
+	}
+	if err := handlers.WaitForShadows(ctx); err != nil {
+		log.Printf("%d shadow calls still running after %s, their events are lost", handlers.ShadowsRunning(), settings.Timeout)
+	}
+}
+
+// clientCertTLSConfig verifies client certificates against the CA bundle
+// when a client presents one. Certificates stay optional so proxied traffic
+// and token-authenticated admin calls keep working.
+func clientCertTLSConfig(caFile string) (*tls.Config, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}, nil
+}
+
+func restoreState(spec string) {
+	stateStore, err := store.Open(spec)
+	if err != nil {
+		log.Fatalf("Invalid state store: %s", err)
+	}
+
+	// Retry logic for the store, like Kafka. Starting on defaults would
+	// silently undo a migration, so give up instead of carrying on.
+	for i := 0; i < 15; i++ {
+		err = config.GlobalConfig.UseStore(stateStore)
+		if err == nil {
+			break
+		}
+		log.Printf("Failed to load routing state: %s. Retrying in 2s...", err)
+		time.Sleep(2 * time.Second)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load routing state: %s", err)
+	}
+
+	_, source := config.GlobalConfig.StateInfo()
+	log.Printf("Routing state store: %s (loaded from %s)", stateStore, source)
 }
@@ -0,0 +1,106 @@
+// Package metrics exposes gateway traffic, comparisons and runtime state in
+// the Prometheus text format. Traffic is counted from the shadow event each
+// request produces; weights, locks, breakers and event sinks are read when
+// /metrics is scraped.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"gateway/events"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_requests_total",
+		Help: "Proxied requests by service, route, mode, primary backend and the status class the client got.",
+	}, []string{"service", "route", "mode", "primary", "status_class"})
+
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_upstream_duration_seconds",
+		Help:    "Latency of calls to each backend, by whether it answered the client (primary) or was mirrored (shadow).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "backend", "role"})
+
+	comparisons = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_shadow_comparisons_total",
+		Help: "Shadowed requests whose legacy and modern responses matched or not.",
+	}, []string{"service", "route", "result"})
+
+	fallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_fallbacks_total",
+		Help: "Requests answered by the other backend after the primary failed, by the primary's error class.",
+	}, []string{"service", "route", "from", "to", "reason"})
+
+	failovers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_failovers_total",
+		Help: "Requests served by the other backend because the chosen primary failed its health checks.",
+	}, []string{"service", "route", "from", "to"})
+)
+
+// Handler serves /metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveShadowEvent counts a finished request from its shadow event.
+func ObserveShadowEvent(event *events.ShadowEvent) {
+	served := event.PrimaryTarget
+	if event.Fallback != nil {
+		served = event.Fallback.To
+		fallbacks.WithLabelValues(event.ServiceType, event.Route, event.Fallback.From, event.Fallback.To, event.Fallback.Reason).Inc()
+	}
+	answer := event.Legacy
+	if served == "modern" {
+		answer = event.Modern
+	}
+	statusClass := "error"
+	if answer != nil && answer.Status > 0 {
+		statusClass = StatusClass(answer.Status)
+	}
+	requests.WithLabelValues(event.ServiceType, event.Route, event.Mode, event.PrimaryTarget, statusClass).Inc()
+
+	if event.Legacy != nil {
+		upstreamDuration.WithLabelValues(event.ServiceType, "legacy", role(event, "legacy")).Observe(event.Legacy.Latency)
+	}
+	if event.Modern != nil {
+		upstreamDuration.WithLabelValues(event.ServiceType, "modern", role(event, "modern")).Observe(event.Modern.Latency)
+	}
+
+	if event.Compared && event.Match != nil {
+		result := "mismatch"
+		if *event.Match {
+			result = "match"
+		}
+		comparisons.WithLabelValues(event.ServiceType, event.Route, result).Inc()
+	}
+}
+
+// ObserveRejected counts a request the gateway answered itself without
+// calling a backend, e.g. because traffic is locked.
+func ObserveRejected(service, route, mode string, status int) {
+	requests.WithLabelValues(service, route, mode, "none", StatusClass(status)).Inc()
+}
+
+// ObserveFailover counts a request that failed over from one backend to the
+// other.
+func ObserveFailover(service, route, from, to string) {
+	failovers.WithLabelValues(service, route, from, to).Inc()
+}
+
+func role(event *events.ShadowEvent, backend string) string {
+	if event.PrimaryTarget == backend {
+		return "primary"
+	}
+	return "shadow"
+}
+
+// StatusClass turns 503 into "5xx".
+func StatusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"gateway/audit"
+	"gateway/breaker"
+	"gateway/config"
+	"gateway/events"
+	"gateway/health"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	weightDesc = prometheus.NewDesc("gateway_weight",
+		"Configured share of traffic answered by modern; route is empty for the service default.",
+		[]string{"service", "route"}, nil)
+	shadowSampleDesc = prometheus.NewDesc("gateway_shadow_sample",
+		"Share of requests mirrored to the backend that is not primary, for the service default.",
+		[]string{"service"}, nil)
+	lockedDesc = prometheus.NewDesc("gateway_traffic_locked",
+		"1 while traffic to the service or route is locked to legacy, including by the global lock.",
+		[]string{"service", "route"}, nil)
+	globalLockedDesc = prometheus.NewDesc("gateway_global_traffic_locked",
+		"1 while the global traffic lock is set.", nil, nil)
+	breakerDesc = prometheus.NewDesc("gateway_circuit_breaker_state",
+		"1 for the state each configured circuit breaker is in.",
+		[]string{"service", "state"}, nil)
+	backendHealthyDesc = prometheus.NewDesc("gateway_backend_healthy",
+		"1 while the backend passes its health check; only backends with a health check are reported.",
+		[]string{"service", "backend"}, nil)
+	sinkEventsDesc = prometheus.NewDesc("gateway_event_sink_events_total",
+		"Events handed to each sink, by whether it took them.",
+		[]string{"sink", "result"}, nil)
+	kafkaDeliveriesDesc = prometheus.NewDesc("gateway_kafka_deliveries_total",
+		"Kafka delivery reports by result.", []string{"result"}, nil)
+	kafkaReachableDesc = prometheus.NewDesc("gateway_kafka_reachable",
+		"1 while the Kafka brokers are reachable.", nil, nil)
+	outboxPendingDesc = prometheus.NewDesc("gateway_kafka_outbox_events",
+		"Events waiting in the Kafka outbox.", nil, nil)
+	outboxSpooledDesc = prometheus.NewDesc("gateway_kafka_outbox_spooled_total",
+		"Events written to the Kafka outbox.", nil, nil)
+	outboxReplayedDesc = prometheus.NewDesc("gateway_kafka_outbox_replayed_total",
+		"Outbox events delivered to Kafka after a replay.", nil, nil)
+	outboxDroppedDesc = prometheus.NewDesc("gateway_kafka_outbox_dropped_total",
+		"Events dropped because the Kafka outbox was full.", nil, nil)
+	outboxCorruptDesc = prometheus.NewDesc("gateway_kafka_outbox_corrupt_total",
+		"Unreadable Kafka outbox lines skipped on replay.", nil, nil)
+	auditCorruptDesc = prometheus.NewDesc("gateway_audit_corrupt_lines",
+		"Unreadable audit log lines skipped when the gateway started.", nil, nil)
+)
+
+// stateCollector reads routing state, breakers, backend health and event
+// sinks on scrape.
+type stateCollector struct {
+	sinks *events.Sinks
+}
+
+// Register adds the routing state, circuit breakers and event sinks to the
+// metrics served by Handler.
+func Register(sinks *events.Sinks) {
+	prometheus.MustRegister(&stateCollector{sinks: sinks})
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		weightDesc, shadowSampleDesc, lockedDesc, globalLockedDesc, breakerDesc, backendHealthyDesc,
+		sinkEventsDesc, kafkaDeliveriesDesc, kafkaReachableDesc,
+		outboxPendingDesc, outboxSpooledDesc, outboxReplayedDesc, outboxDroppedDesc, outboxCorruptDesc,
+		auditCorruptDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	globalLocked := config.GlobalConfig.IsTrafficLocked()
+	ch <- prometheus.MustNewConstMetric(globalLockedDesc, prometheus.GaugeValue, boolValue(globalLocked))
+	ch <- prometheus.MustNewConstMetric(auditCorruptDesc, prometheus.GaugeValue, float64(audit.GlobalLog.Corrupt()))
+
+	migrations := config.GlobalConfig.ListMigrations()
+	for _, m := range migrations {
+		ch <- prometheus.MustNewConstMetric(weightDesc, prometheus.GaugeValue, m.Weight, m.Name, "")
+		ch <- prometheus.MustNewConstMetric(shadowSampleDesc, prometheus.GaugeValue, m.EffectiveShadowSample(nil), m.Name)
+		ch <- prometheus.MustNewConstMetric(lockedDesc, prometheus.GaugeValue, boolValue(globalLocked || m.TrafficLocked), m.Name, "")
+
+		for _, rule := range m.Routes {
+			if rule.Weight != nil {
+				ch <- prometheus.MustNewConstMetric(weightDesc, prometheus.GaugeValue, *rule.Weight, m.Name, rule.Key())
+			}
+			if rule.TrafficLocked {
+				ch <- prometheus.MustNewConstMetric(lockedDesc, prometheus.GaugeValue, 1, m.Name, rule.Key())
+			}
+		}
+	}
+
+	for _, status := range breaker.Global.Status(migrations) {
+		for _, state := range []string{breaker.Closed, breaker.Open, breaker.HalfOpen} {
+			ch <- prometheus.MustNewConstMetric(breakerDesc, prometheus.GaugeValue, boolValue(status.State == state), status.Service, state)
+		}
+	}
+
+	for _, status := range health.Global.Status() {
+		ch <- prometheus.MustNewConstMetric(backendHealthyDesc, prometheus.GaugeValue, boolValue(status.Healthy), status.Service, status.Backend)
+	}
+
+	if c.sinks == nil {
+		return
+	}
+	for _, counts := range c.sinks.Counts() {
+		ch <- prometheus.MustNewConstMetric(sinkEventsDesc, prometheus.CounterValue, float64(counts.Sent), counts.Name, "sent")
+		ch <- prometheus.MustNewConstMetric(sinkEventsDesc, prometheus.CounterValue, float64(counts.Failed), counts.Name, "failed")
+	}
+	if c.sinks.Kafka != nil {
+		stats := c.sinks.Kafka.Stats()
+		ch <- prometheus.MustNewConstMetric(kafkaDeliveriesDesc, prometheus.CounterValue, float64(stats.Acked), "acked")
+		ch <- prometheus.MustNewConstMetric(kafkaDeliveriesDesc, prometheus.CounterValue, float64(stats.Failed), "failed")
+		ch <- prometheus.MustNewConstMetric(kafkaReachableDesc, prometheus.GaugeValue, boolValue(stats.Connected && stats.Reachable))
+		ch <- prometheus.MustNewConstMetric(outboxSpooledDesc, prometheus.CounterValue, float64(stats.Spooled))
+		ch <- prometheus.MustNewConstMetric(outboxReplayedDesc, prometheus.CounterValue, float64(stats.Replayed))
+		if stats.Outbox != nil {
+			ch <- prometheus.MustNewConstMetric(outboxPendingDesc, prometheus.GaugeValue, float64(stats.Outbox.Pending))
+			ch <- prometheus.MustNewConstMetric(outboxDroppedDesc, prometheus.CounterValue, float64(stats.Outbox.Dropped))
+			ch <- prometheus.MustNewConstMetric(outboxCorruptDesc, prometheus.CounterValue, float64(stats.Outbox.Corrupt))
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
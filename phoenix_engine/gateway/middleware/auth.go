@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"gateway/auth"
+)
+
+// AdminAuth protects an admin endpoint. Reads (GET, HEAD) need the viewer
+// role and everything else needs operator; CORS preflights pass through.
+// With a nil authenticator the endpoint stays open, as it always was.
+func AdminAuth(authenticator auth.Authenticator, next http.HandlerFunc) http.HandlerFunc {
+	if authenticator == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		required := auth.Operator
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			required = auth.Viewer
+		}
+
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			reason := err.Error()
+			if errors.Is(err, auth.ErrNoCredentials) {
+				reason = "no credentials"
+			}
+			logDenied(r, "unauthenticated", reason)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="phoenix-gateway-admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if principal.Role < required {
+			logDenied(r, principal.Name, "role "+principal.Role.String()+" needs "+required.String())
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	}
+}
+
+func logDenied(r *http.Request, who, reason string) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	slog.Warn("admin request denied", "method", r.Method, "path", r.URL.Path, "remote_ip", ip, "principal", who, "reason", reason)
+}
@@ -1,14 +1,17 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"gateway/logging"
 )
 
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -16,24 +19,35 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// LoggingMiddleware writes one access-log record per request. Attributes the
+// handler adds with logging.With, such as the transaction ID, service and
+// route, are included.
 func LoggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		
+		ctx := logging.WithRequest(r.Context())
+
 		wrapped := &responseWriter{
 			ResponseWriter: w,
 			statusCode:     http.StatusOK,
 		}
-		
-		next(wrapped, r)
-		
-		duration := time.Since(start)
-		log.Printf("[%s] %s %s - %d (%v)", 
-			r.Method, 
-			r.URL.Path, 
-			r.RemoteAddr, 
-			wrapped.statusCode, 
-			duration,
-		)
+
+		next(wrapped, r.WithContext(ctx))
+
+		args := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote_addr", r.RemoteAddr,
+			"status", wrapped.statusCode,
+			"bytes", wrapped.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+		}
+		slog.InfoContext(ctx, "request", append(args, logging.Attrs(ctx)...)...)
 	}
 }
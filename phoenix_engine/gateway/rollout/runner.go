@@ -0,0 +1,77 @@
+// Package rollout executes the progressive rollout plans started through
+// /admin/rollouts. Plan state lives in config so it is persisted with the
+// rest of the routing state.
+package rollout
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gateway/audit"
+	"gateway/config"
+)
+
+// Run advances due plans every interval until the process exits.
+func Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		Advance(time.Now().UTC())
+	}
+}
+
+// Advance moves every plan whose dwell time has passed to its next step,
+// records each change in the audit log and persists the new state.
+func Advance(now time.Time) {
+	changes := config.GlobalConfig.AdvanceRollouts(now)
+	if len(changes) == 0 {
+		return
+	}
+
+	for _, change := range changes {
+		ro := change.Rollout
+		slog.Info("rollout advanced", "rollout", ro.ID, "service", ro.Service, "route", ro.Route(),
+			"old_weight", change.OldWeight, "new_weight", change.NewWeight,
+			"step", ro.CurrentStep+1, "steps", len(ro.Steps), "state", ro.State)
+		audit.GlobalLog.Record(audit.Entry{
+			Actor:    "rollout:" + ro.ID,
+			Action:   "rollout-step",
+			Service:  ro.Service,
+			Route:    ro.Route(),
+			OldValue: change.OldWeight,
+			NewValue: change.NewWeight,
+			Reason:   fmt.Sprintf("step %d of %d", ro.CurrentStep+1, len(ro.Steps)),
+		})
+	}
+
+	if err := config.GlobalConfig.Persist(); err != nil {
+		slog.Error("failed to persist rollout progress", "error", err)
+	}
+}
+
+// AbortFor aborts every active plan for service, for example when its
+// circuit breaker opens, and persists the result.
+func AbortFor(service, reason string) {
+	aborted := config.GlobalConfig.AbortRolloutsFor(service, reason, time.Now().UTC())
+	if len(aborted) == 0 {
+		return
+	}
+
+	for _, ro := range aborted {
+		slog.Warn("rollout aborted", "rollout", ro.ID, "service", ro.Service, "route", ro.Route(), "reason", reason)
+		audit.GlobalLog.Record(audit.Entry{
+			Actor:    "rollout:" + ro.ID,
+			Action:   "rollout-abort",
+			Service:  ro.Service,
+			Route:    ro.Route(),
+			NewValue: config.RolloutAborted,
+			Reason:   reason,
+		})
+	}
+
+	if err := config.GlobalConfig.Persist(); err != nil {
+		slog.Error("failed to persist rollout progress", "error", err)
+	}
+}
@@ -2,87 +2,62 @@ package router
 
 import (
 	"net/http"
-	"os"
-	"strings"
 
+	"gateway/auth"
+	"gateway/breaker"
+	"gateway/config"
+	"gateway/events"
 	"gateway/handlers"
+	"gateway/metrics"
 	"gateway/middleware"
-	"gateway/services"
+	"gateway/tracing"
 )
 
-func SetupRoutes(kafkaService *services.KafkaService) {
-	// Admin endpoints
-	http.HandleFunc("/admin/set-weight", middleware.LoggingMiddleware(handlers.SetWeightHandler))
-	http.HandleFunc("/admin/traffic-lock", middleware.LoggingMiddleware(handlers.TrafficLockHandler))
-	http.HandleFunc("/admin/status", handlers.StatusHandler) // No logging to reduce noise
-
-	// Legacy transfer endpoints (kept for backwards compatibility)
-	http.HandleFunc("/python/transfer", middleware.LoggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		handlers.HandleTransfer(
-			w, r,
-			"python",
-			os.Getenv("LEGACY_PYTHON_URL"),
-			os.Getenv("MODERN_PYTHON_URL"),
-			kafkaService,
-		)
-	}))
+func SetupRoutes(publishers handlers.Publishers, sinks *events.Sinks, authenticator auth.Authenticator) {
+	admin := func(handler http.HandlerFunc) http.HandlerFunc {
+		return middleware.AdminAuth(authenticator, handler)
+	}
 
-	http.HandleFunc("/php/transfer", middleware.LoggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		handlers.HandleTransfer(
-			w, r,
-			"php",
-			os.Getenv("LEGACY_PHP_URL"),
-			os.Getenv("MODERN_GO_URL"),
-			kafkaService,
-		)
-	}))
-
-	// Dynamic routing: /php/* goes to PHP legacy and Go modern
-	http.HandleFunc("/php/", middleware.LoggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		// Extract the path after /php/
-		path := strings.TrimPrefix(r.URL.Path, "/php")
-		
-		// Build backend URLs
-		legacyURL := os.Getenv("LEGACY_PHP_URL")
-		modernURL := os.Getenv("MODERN_GO_URL")
-		
-		// If no env vars, use defaults
-		if legacyURL == "" {
-			legacyURL = "http://localhost:8080"
-		}
-		if modernURL == "" {
-			modernURL = "http://localhost:8081"
+	// Admin endpoints
+	http.HandleFunc("/admin/set-weight", middleware.LoggingMiddleware(admin(handlers.SetWeightHandler)))
+	http.HandleFunc("/admin/shadow-sample", middleware.LoggingMiddleware(admin(handlers.ShadowSampleHandler)))
+	http.HandleFunc("/admin/traffic-lock", middleware.LoggingMiddleware(admin(handlers.TrafficLockHandler)))
+	http.HandleFunc("/admin/migrations", middleware.LoggingMiddleware(admin(handlers.MigrationsHandler)))
+	http.HandleFunc("/admin/migrations/", middleware.LoggingMiddleware(admin(handlers.MigrationsHandler)))
+	http.HandleFunc("/admin/rollouts", middleware.LoggingMiddleware(admin(handlers.RolloutsHandler)))
+	http.HandleFunc("/admin/rollouts/", middleware.LoggingMiddleware(admin(handlers.RolloutsHandler)))
+	http.HandleFunc("/admin/circuit-breakers", middleware.LoggingMiddleware(admin(handlers.CircuitBreakerHandler)))
+	http.HandleFunc("/admin/circuit-breakers/reset", middleware.LoggingMiddleware(admin(handlers.CircuitBreakerHandler)))
+	http.HandleFunc("/admin/audit", middleware.LoggingMiddleware(admin(handlers.AuditHandler)))
+	http.HandleFunc("/admin/event-schemas", middleware.LoggingMiddleware(admin(handlers.EventSchemaHandler)))
+	http.HandleFunc("/admin/event-schemas/", middleware.LoggingMiddleware(admin(handlers.EventSchemaHandler)))
+	http.HandleFunc("/admin/event-sinks", middleware.LoggingMiddleware(admin(handlers.EventSinksHandler(sinks))))
+	if sinks.Memory != nil {
+		http.HandleFunc("/admin/events", middleware.LoggingMiddleware(admin(handlers.EventsHandler(sinks.Memory))))
+	}
+	http.HandleFunc("/admin/status", admin(handlers.StatusHandler)) // No logging to reduce noise
+
+	// Prometheus scrapes and orchestrator probes come without admin credentials
+	http.Handle("/metrics", metrics.Handler())
+	http.HandleFunc("/healthz", handlers.HealthHandler)
+	http.HandleFunc("/readyz", handlers.ReadyHandler)
+
+	// Every other path is looked up in the migration registry, so migrations
+	// added at runtime are served without a code change.
+	http.HandleFunc("/", middleware.LoggingMiddleware(tracing.Handler(func(w http.ResponseWriter, r *http.Request) {
+		target, ok := config.GlobalConfig.Resolve(r.Method, r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
 		}
+		target = breaker.Global.Admit(target)
 
-		handlers.HandleDynamicTransfer(
-			w, r,
-			"php",
-			legacyURL + path,
-			modernURL + path,
-			kafkaService,
-		)
-	}))
-
-	// Dynamic routing: /python/* goes to Python legacy and modern
-	http.HandleFunc("/python/", middleware.LoggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		path := strings.TrimPrefix(r.URL.Path, "/python")
-		
-		legacyURL := os.Getenv("LEGACY_PYTHON_URL")
-		modernURL := os.Getenv("MODERN_PYTHON_URL")
-		
-		if legacyURL == "" {
-			legacyURL = "http://localhost:5001"
-		}
-		if modernURL == "" {
-			modernURL = "http://localhost:5002"
+		// <prefix>/transfer keeps its dedicated transfer-funds handler
+		if target.Path == "/transfer" {
+			handlers.HandleTransfer(w, r, target, publishers)
+			return
 		}
 
-		handlers.HandleDynamicTransfer(
-			w, r,
-			"python",
-			legacyURL + path,
-			modernURL + path,
-			kafkaService,
-		)
-	}))
+		handlers.HandleDynamicTransfer(w, r, target, publishers)
+	})))
 }
@@ -1,59 +1,213 @@
+//go:build !nokafka
+
 package services
 
 import (
-	"log"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
+// KafkaAvailable reports whether this binary was built with Kafka support.
+const KafkaAvailable = true
+
+// messageTimeout bounds how long librdkafka retries a message before its
+// delivery report says it failed.
+const messageTimeout = 30 * time.Second
+
+// KafkaStats counts delivery reports since the producer was created.
+type KafkaStats struct {
+	Acked       int64      `json:"acked"`
+	Failed      int64      `json:"failed"`
+	Pending     int        `json:"pending"` // Produced, not yet acknowledged
+	Reachable   bool       `json:"reachable"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
 type KafkaService struct {
 	Producer *kafka.Producer
 	Topic    string
+
+	onFailed func(topic string, value []byte, err error)
+	mu       sync.Mutex
+	stats    KafkaStats
+	done     chan struct{}
 }
 
-func NewKafkaService(bootstrapServers, topic string) (*KafkaService, error) {
-	var producer *kafka.Producer
-	var err error
-	
-	// Retry logic for Kafka connection
-	for i := 0; i < 30; i++ {
-		producer, err = kafka.NewProducer(&kafka.ConfigMap{
-			"bootstrap.servers": bootstrapServers,
-		})
-		if err == nil {
-			break
-		}
-		log.Printf("Failed to create Kafka producer: %s. Retrying in 2s...", err)
-		time.Sleep(2 * time.Second)
-	}
-	
+// NewKafkaService creates a producer and starts draining its delivery
+// reports. onFailed, if set, receives every message Kafka could not deliver.
+// librdkafka connects in the background, so a broker that is down does not
+// make this fail; it shows up as Reachable false in Stats.
+func NewKafkaService(bootstrapServers, topic string, onFailed func(topic string, value []byte, err error)) (*KafkaService, error) {
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{
+		"bootstrap.servers":  bootstrapServers,
+		"message.timeout.ms": int(messageTimeout / time.Millisecond),
+	})
 	if err != nil {
 		return nil, err
 	}
-	
-	return &KafkaService{
+
+	k := &KafkaService{
 		Producer: producer,
 		Topic:    topic,
-	}, nil
+		onFailed: onFailed,
+		stats:    KafkaStats{Reachable: true},
+		done:     make(chan struct{}),
+	}
+	go k.handleEvents()
+	return k, nil
+}
+
+// handleEvents drains delivery reports and client errors until the producer
+// is closed.
+func (k *KafkaService) handleEvents() {
+	defer close(k.done)
+
+	for e := range k.Producer.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			err := ev.TopicPartition.Error
+			k.recordDelivery(err)
+			if err != nil && k.onFailed != nil {
+				topic := ""
+				if ev.TopicPartition.Topic != nil {
+					topic = *ev.TopicPartition.Topic
+				}
+				k.onFailed(topic, ev.Value, err)
+			}
+		case kafka.Error:
+			slog.Error("kafka error", "code", ev.Code().String(), "error", ev)
+			k.mu.Lock()
+			k.setErrorLocked(ev)
+			if ev.Code() == kafka.ErrAllBrokersDown {
+				k.stats.Reachable = false
+			}
+			k.mu.Unlock()
+		}
+	}
+}
+
+func (k *KafkaService) recordDelivery(err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err != nil {
+		k.stats.Failed++
+		k.stats.Reachable = false
+		k.setErrorLocked(err)
+		return
+	}
+	k.stats.Acked++
+	k.stats.Reachable = true
+}
+
+func (k *KafkaService) setErrorLocked(err error) {
+	now := time.Now()
+	k.stats.LastError = err.Error()
+	k.stats.LastErrorAt = &now
+}
+
+// Stats reports delivery counters and whether the brokers were reachable
+// the last time the producer heard from them.
+func (k *KafkaService) Stats() KafkaStats {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	stats := k.stats
+	stats.Pending = k.Producer.Len()
+	return stats
+}
+
+// Reachable reports false after all brokers went down or a delivery failed,
+// until the next successful delivery.
+func (k *KafkaService) Reachable() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.stats.Reachable
 }
 
 func (k *KafkaService) SendMessage(value []byte) error {
+	return k.SendMessageTo(k.Topic, value)
+}
+
+// SendMessageTo produces value to a topic other than the service's default.
+// The outcome arrives later as a delivery report.
+func (k *KafkaService) SendMessageTo(topic string, value []byte) error {
 	if k.Producer == nil {
-		return nil // Gracefully handle nil producer
+		return nil
 	}
-	
+
 	return k.Producer.Produce(&kafka.Message{
 		TopicPartition: kafka.TopicPartition{
-			Topic:     &k.Topic,
+			Topic:     &topic,
 			Partition: kafka.PartitionAny,
 		},
 		Value: value,
 	}, nil)
 }
 
-func (k *KafkaService) Close() {
-	if k.Producer != nil {
-		k.Producer.Close()
+// SendBatchSync produces values in order and waits for their delivery
+// reports. It returns how many leading messages were delivered and the first
+// error.
+func (k *KafkaService) SendBatchSync(topics []string, values [][]byte) (int, error) {
+	delivered := make(chan kafka.Event, len(values))
+	for i := range values {
+		topic := topics[i]
+		err := k.Producer.Produce(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{
+				Topic:     &topic,
+				Partition: kafka.PartitionAny,
+			},
+			Value:  values[i],
+			Opaque: i,
+		}, delivered)
+		if err != nil {
+			values = values[:i]
+			break
+		}
+	}
+
+	// Reports can arrive out of order across partitions
+	ok := make([]bool, len(values))
+	var firstErr error
+	for range values {
+		msg := (<-delivered).(*kafka.Message)
+		k.recordDelivery(msg.TopicPartition.Error)
+		if msg.TopicPartition.Error != nil {
+			if firstErr == nil {
+				firstErr = msg.TopicPartition.Error
+			}
+			continue
+		}
+		ok[msg.Opaque.(int)] = true
+	}
+
+	n := 0
+	for n < len(ok) && ok[n] {
+		n++
+	}
+	if firstErr == nil && n < len(topics) {
+		firstErr = kafka.NewError(kafka.ErrQueueFull, "producer queue is full", false)
+	}
+	return n, firstErr
+}
+
+// Close waits up to timeout for queued messages to be delivered. Messages
+// still queued after that are purged and reported to onFailed before the
+// producer is closed.
+func (k *KafkaService) Close(timeout time.Duration) {
+	if k.Producer == nil {
+		return
+	}
+
+	if remaining := k.Producer.Flush(int(timeout / time.Millisecond)); remaining > 0 {
+		slog.Warn("kafka flush timed out, purging outstanding messages", "outstanding", remaining)
+		k.Producer.Purge(kafka.PurgeQueue | kafka.PurgeInFlight)
+		k.Producer.Flush(1000)
 	}
+	k.Producer.Close()
+	<-k.done
 }
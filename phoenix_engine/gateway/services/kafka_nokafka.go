@@ -0,0 +1,55 @@
+//go:build nokafka
+
+package services
+
+import (
+	"errors"
+	"time"
+)
+
+// KafkaAvailable reports whether this binary was built with Kafka support.
+const KafkaAvailable = false
+
+// KafkaStats mirrors the real producer's counters.
+type KafkaStats struct {
+	Acked       int64      `json:"acked"`
+	Failed      int64      `json:"failed"`
+	Pending     int        `json:"pending"`
+	Reachable   bool       `json:"reachable"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// KafkaService stands in for the librdkafka producer in binaries built with
+// -tags nokafka, so the gateway builds and runs without cgo or a broker.
+type KafkaService struct {
+	Topic string
+}
+
+var errNoKafka = errors.New("Kafka support is not compiled in (built with -tags nokafka)")
+
+func NewKafkaService(bootstrapServers, topic string, onFailed func(topic string, value []byte, err error)) (*KafkaService, error) {
+	return nil, errNoKafka
+}
+
+func (k *KafkaService) Stats() KafkaStats {
+	return KafkaStats{}
+}
+
+func (k *KafkaService) Reachable() bool {
+	return false
+}
+
+func (k *KafkaService) SendMessage(value []byte) error {
+	return errNoKafka
+}
+
+func (k *KafkaService) SendMessageTo(topic string, value []byte) error {
+	return errNoKafka
+}
+
+func (k *KafkaService) SendBatchSync(topics []string, values [][]byte) (int, error) {
+	return 0, errNoKafka
+}
+
+func (k *KafkaService) Close(timeout time.Duration) {}
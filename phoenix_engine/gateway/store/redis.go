@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gateway/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// stateKey is the Redis key holding the gateway routing state. It sits next
+// to the arbiter's own keys in the same database.
+const stateKey = "gateway:routing_state"
+
+// RedisStore keeps the routing state as one JSON value in Redis.
+type RedisStore struct {
+	client *redis.Client
+	addr   string
+}
+
+func NewRedisStore(redisURL string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{
+		client: redis.NewClient(opts),
+		addr:   opts.Addr,
+	}, nil
+}
+
+func (s *RedisStore) Load() (*config.Snapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, stateKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot config.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (s *RedisStore) Save(snapshot *config.Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.client.Set(ctx, stateKey, data, 0).Err()
+}
+
+func (s *RedisStore) String() string {
+	return "redis:" + s.addr + "/" + stateKey
+}
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+
+	"gateway/config"
+)
+
+// Open builds a state store from a spec such as "file:///data/gateway-state.json"
+// or "redis://redis:6379/0".
+func Open(spec string) (config.StateStore, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state store %q: %w", spec, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		path := u.Path
+		if u.Opaque != "" {
+			path = u.Opaque // file:relative/path
+		}
+		if path == "" {
+			return nil, fmt.Errorf("state store %q has no file path", spec)
+		}
+		return NewFileStore(path), nil
+	case "redis":
+		return NewRedisStore(spec)
+	}
+	return nil, fmt.Errorf("unsupported state store %q (use file:// or redis://)", spec)
+}
@@ -0,0 +1,188 @@
+// Package tracing records OpenTelemetry spans for proxied requests: a server
+// span for the client's call and a client span for every upstream call, with
+// the W3C trace context forwarded to both backends.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"gateway/config"
+	"gateway/events"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "gateway"
+
+// FromConfig installs the tracer provider and the W3C trace context
+// propagator. The returned function flushes pending spans; call it before
+// exiting. With the exporter set to none, spans are not recorded but the
+// caller's traceparent is still forwarded to the backends.
+func FromConfig(cfg config.TracingFile) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	switch cfg.Exporter {
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		var err error
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("otlp exporter: %w", err)
+		}
+		log.Printf("Tracing: exporting spans over OTLP (sample ratio %.2f)", cfg.SampleRatio)
+	case "file":
+		var err error
+		file, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		log.Printf("Tracing: writing spans to %s (sample ratio %.2f)", cfg.File, cfg.SampleRatio)
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// statusRecorder remembers the status the handler answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *statusRecorder) WriteHeader(code int) {
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Handler starts a server span for each request, continuing the caller's
+// trace when the request carries a traceparent header.
+func Handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer().Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethod(r.Method), semconv.HTTPTarget(r.URL.Path)))
+		defer span.End()
+
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPStatusCode(rw.status))
+		if rw.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rw.status))
+		}
+	}
+}
+
+// RecordShadowEvent puts the routing decision on the request's span. The
+// transaction ID is the key that joins the trace to the logs and to the
+// shadow-request event. When both backends were compared, the verdict goes
+// on a "shadow comparison" span of its own: with async shadowing the
+// comparison is only known after the request's span has ended, which then
+// no longer takes attributes.
+func RecordShadowEvent(ctx context.Context, event *events.ShadowEvent) {
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		if event.Route != "" {
+			span.SetName(event.Route)
+			span.SetAttributes(semconv.HTTPRoute(event.Route))
+		} else {
+			span.SetName(event.Method + " " + event.Path)
+		}
+		span.SetAttributes(
+			attribute.String("phoenix.transaction_id", event.TransactionID),
+			attribute.String("phoenix.service", event.ServiceType),
+			attribute.String("phoenix.mode", event.Mode),
+			attribute.Float64("phoenix.weight", event.Weight),
+			attribute.Float64("phoenix.shadow_sample", event.ShadowSample),
+			attribute.String("phoenix.primary_target", event.PrimaryTarget),
+		)
+	}
+	if event.Compared {
+		recordComparison(ctx, event)
+	}
+}
+
+// recordComparison starts and ends a child of ctx's span carrying the
+// comparison. A child may start after its parent ended, so it lands in the
+// request's trace even when called from the shadow goroutine.
+func recordComparison(ctx context.Context, event *events.ShadowEvent) {
+	_, span := tracer().Start(ctx, "shadow comparison", trace.WithAttributes(
+		attribute.String("phoenix.transaction_id", event.TransactionID),
+		attribute.String("phoenix.service", event.ServiceType),
+		attribute.Bool("phoenix.match", event.Match != nil && *event.Match),
+		attribute.Int("phoenix.legacy_status", event.LegacyStatus),
+		attribute.Int("phoenix.modern_status", event.ModernStatus),
+	))
+	defer span.End()
+	if event.BodyMatch != nil {
+		span.SetAttributes(attribute.Bool("phoenix.body_match", *event.BodyMatch))
+	}
+	if len(event.DiffPaths) > 0 {
+		span.SetAttributes(
+			attribute.StringSlice("phoenix.diff_paths", event.DiffPaths),
+			attribute.Bool("phoenix.diff_truncated", event.DiffTruncated),
+		)
+	}
+}
+
+// TraceID is the trace ctx belongs to, or "" outside a trace.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Detach keeps ctx's span but drops its deadline and cancellation, for
+// upstream calls that must not be cut short when the client goes away.
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+}
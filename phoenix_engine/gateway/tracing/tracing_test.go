@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"gateway/events"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRecordShadowEventAfterRequestSpanEnded(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	// Async shadowing: the comparison arrives after the server span ended
+	ctx, request := tracer().Start(context.Background(), "HTTP POST")
+	request.End()
+
+	match := false
+	RecordShadowEvent(ctx, &events.ShadowEvent{
+		TransactionID: "tx-1",
+		Compared:      true,
+		Match:         &match,
+		DiffPaths:     []string{"balance"},
+	})
+
+	var comparison sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "shadow comparison" {
+			comparison = span
+		}
+	}
+	if comparison == nil {
+		t.Fatal("no shadow comparison span recorded")
+	}
+	if comparison.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Fatal("comparison span is not a child of the request span")
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range comparison.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if v, ok := attrs["phoenix.match"]; !ok || v.AsBool() {
+		t.Fatalf("phoenix.match = %v; want false", v.AsBool())
+	}
+	if v := attrs["phoenix.diff_paths"].AsStringSlice(); len(v) != 1 || v[0] != "balance" {
+		t.Fatalf("phoenix.diff_paths = %v; want [balance]", v)
+	}
+}
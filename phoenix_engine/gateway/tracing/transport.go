@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type upstreamKey struct{}
+
+type upstream struct {
+	backend string // "legacy" or "modern"
+	role    string // "primary", "shadow" or "fallback"
+}
+
+// WithUpstream labels the calls made with ctx, so their spans say which
+// backend they went to and whether the client got that backend's answer.
+func WithUpstream(ctx context.Context, backend, role string) context.Context {
+	return context.WithValue(ctx, upstreamKey{}, upstream{backend: backend, role: role})
+}
+
+// Transport starts a client span for every upstream call and injects the
+// traceparent header into the forwarded request. The span ends once the
+// response body is read or closed.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := "HTTP " + req.Method
+	attrs := []attribute.KeyValue{semconv.HTTPMethod(req.Method), semconv.HTTPURL(req.URL.String())}
+	if u, ok := req.Context().Value(upstreamKey{}).(upstream); ok {
+		name = u.backend + " " + req.Method
+		attrs = append(attrs, attribute.String("phoenix.backend", u.backend), attribute.String("phoenix.role", u.role))
+	}
+
+	ctx, span := tracer().Start(req.Context(), name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span}
+	return resp, nil
+}
+
+// spanBody ends the span at EOF or Close, whichever comes first.
+type spanBody struct {
+	io.ReadCloser
+	span trace.Span
+	once sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.end()
+	} else if err != nil {
+		b.span.RecordError(err)
+		b.span.SetStatus(codes.Error, err.Error())
+		b.end()
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	b.end()
+	return b.ReadCloser.Close()
+}
+
+func (b *spanBody) end() {
+	b.once.Do(func() { b.span.End() })
+}
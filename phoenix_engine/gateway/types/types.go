@@ -1,19 +1,107 @@
 package types
 
+import "gateway/config"
+
+// WeightRequest sets the service weight, or the weight of a single route
+// when Path is given (Method is optional and matches any method if empty).
 type WeightRequest struct {
 	Service string  `json:"service"`
+	Method  string  `json:"method,omitempty"`
+	Path    string  `json:"path,omitempty"`
 	Weight  float64 `json:"weight"`
+	Reason  string  `json:"reason,omitempty"` // Recorded in the audit log
+}
+
+// ShadowSampleRequest sets the share of requests mirrored to the backend
+// that is not primary, for a service or one route. A null Sample restores
+// the default (inherit, or mirror everything while 0 < weight < 1).
+type ShadowSampleRequest struct {
+	Service string   `json:"service"`
+	Method  string   `json:"method,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	Sample  *float64 `json:"sample"`
+	Reason  string   `json:"reason,omitempty"` // Recorded in the audit log
+}
+
+type ShadowSampleResponse struct {
+	Service string  `json:"service"`
+	Route   string  `json:"route,omitempty"`
+	Sample  float64 `json:"sample"` // Effective value after defaults
 }
 
 type TrafficLockRequest struct {
-	Locked bool `json:"locked"`
+	Service string `json:"service,omitempty"` // Empty means the global lock
+	Method  string `json:"method,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Locked  bool   `json:"locked"`
+	Reason  string `json:"reason,omitempty"` // Recorded in the audit log
 }
 
 type TrafficLockResponse struct {
-	Locked bool `json:"locked"`
+	Service string `json:"service,omitempty"`
+	Method  string `json:"method,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Locked  bool   `json:"locked"`
 }
 
 type WeightResponse struct {
 	Service string  `json:"service"`
+	Route   string  `json:"route,omitempty"` // Matched route rule, if any
 	Weight  float64 `json:"weight"`
 }
+
+// MigrationRequest creates or updates a registry entry. On update, fields
+// left out of the body keep their current value.
+type MigrationRequest struct {
+	Name          string   `json:"name"`
+	PathPrefix    *string  `json:"path_prefix"`
+	LegacyURL     *string  `json:"legacy_url"`
+	ModernURL     *string  `json:"modern_url"`
+	Weight        *float64 `json:"weight"`
+	ShadowSample  *float64 `json:"shadow_sample"`
+	TrafficLocked *bool    `json:"traffic_locked"`
+	StickyKey     *string  `json:"sticky_key"`
+
+	// CircuitBreaker replaces the breaker settings when present
+	CircuitBreaker *config.CircuitBreaker `json:"circuit_breaker"`
+
+	// Compare replaces the response comparison rules when present
+	Compare *config.CompareRules `json:"compare"`
+
+	// HealthCheck replaces the active health check settings when present
+	HealthCheck *config.HealthCheck `json:"health_check"`
+
+	// Fallback replaces the service's fallback policy when present
+	Fallback config.FallbackPolicy `json:"fallback"`
+
+	// Upstream replaces the service's connection settings when present
+	Upstream *config.Upstream `json:"upstream"`
+
+	// Routes replaces the full list of per-route overrides when present
+	Routes *[]config.RouteRule `json:"routes"`
+
+	Reason string `json:"reason,omitempty"` // Recorded in the audit log
+}
+
+// RolloutRequest starts a progressive rollout. Weights is shorthand for
+// Steps that all use MinDwell, e.g. [0.01, 0.05, 0.25, 0.5, 1].
+type RolloutRequest struct {
+	Service  string               `json:"service"`
+	Method   string               `json:"method,omitempty"`
+	Path     string               `json:"path,omitempty"` // Ramps one route instead of the service
+	Weights  []float64            `json:"weights,omitempty"`
+	Steps    []config.RolloutStep `json:"steps,omitempty"`
+	MinDwell config.Duration      `json:"min_dwell"`
+	Reason   string               `json:"reason,omitempty"` // Recorded in the audit log
+}
+
+// RolloutActionRequest is the optional body of pause, resume and abort.
+type RolloutActionRequest struct {
+	Rollback bool   `json:"rollback,omitempty"` // Abort only: restore the weight from before the plan
+	Reason   string `json:"reason,omitempty"`
+}
+
+type BreakerResetRequest struct {
+	Service string `json:"service"`
+	Reason  string `json:"reason,omitempty"` // Recorded in the audit log
+}
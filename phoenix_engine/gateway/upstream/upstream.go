@@ -0,0 +1,89 @@
+// Package upstream owns the HTTP connections to the legacy and modern
+// backends. Requests and shadow calls share one pooled, traced transport per
+// set of connection settings, so keep-alive connections to a backend are
+// reused instead of dialed per request.
+package upstream
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"gateway/config"
+	"gateway/tracing"
+)
+
+var (
+	mu         sync.Mutex
+	transports = map[config.Upstream]http.RoundTripper{}
+	clients    = map[config.Upstream]*http.Client{}
+)
+
+// Client returns the shared client for target's backends. It sets no
+// overall timeout; every call carries its deadline in its context.
+//
+// Clients are keyed by connection settings rather than by service and
+// backend on purpose. http.Transport already keeps a separate pool per
+// scheme, host and port, so every backend has its own idle connections.
+// Sharing the transport means a backend behind several migrations reuses
+// those connections, and max_conns_per_host caps the backend as a whole,
+// which is what protects it. A migration that needs its own limits sets
+// its own upstream settings and gets its own transport.
+func Client(target config.RouteTarget) *http.Client {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if client, ok := clients[target.Upstream]; ok {
+		return client
+	}
+	client := &http.Client{Transport: transport(target.Upstream)}
+	clients[target.Upstream] = client
+	return client
+}
+
+// transport returns the traced transport for settings, creating it on first
+// use. http.Transport keeps a separate pool per backend host, so migrations
+// with the same settings share a transport but not connections. A transport
+// whose settings were changed by a reload is no longer handed out; its idle
+// connections close after IdleConnTimeout. Callers hold mu.
+func transport(settings config.Upstream) http.RoundTripper {
+	if rt, ok := transports[settings]; ok {
+		return rt
+	}
+	rt := tracing.NewTransport(newTransport(settings))
+	transports[settings] = rt
+	return rt
+}
+
+func newTransport(settings config.Upstream) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(settings.DialTimeout),
+		KeepAlive: time.Duration(settings.KeepAlive),
+	}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   time.Duration(settings.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: time.Duration(settings.ResponseHeaderTimeout),
+		IdleConnTimeout:       time.Duration(settings.IdleConnTimeout),
+		MaxIdleConns:          settings.MaxIdleConns,
+		MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       settings.MaxConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}
+	if settings.CAFile != "" {
+		// Validated when the config was loaded; a file changed since then
+		// falls back to the system roots
+		pool, err := config.LoadCertPool(settings.CAFile)
+		if err != nil {
+			log.Printf("Failed to load upstream CA file, using system roots: %s", err)
+		} else {
+			t.TLSClientConfig = &tls.Config{RootCAs: pool}
+		}
+	}
+	return t
+}
@@ -0,0 +1,116 @@
+package upstream
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gateway/config"
+)
+
+var benchBody = []byte(`{"account_number":"ACC-1001","amount":25.5,"currency":"EUR","transaction_id":"bench"}`)
+
+// BenchmarkClient compares the pool with the gateway's previous client under
+// shadowing load: every operation sends one request to a legacy and a modern
+// test server in parallel and reads both answers, like a sampled request.
+//
+//	go test ./upstream -run '^$' -bench Client -benchmem
+//
+// Besides ns/op and allocations it reports the p99 latency and how many
+// connections each approach dialed.
+func BenchmarkClient(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		client func() *http.Client
+	}{
+		// What the handlers did before this package: a client per request
+		// with the overall timeout, on the default transport
+		{"baseline", func() *http.Client { return &http.Client{Timeout: 30 * time.Second} }},
+		{"pool", func() *http.Client {
+			return Client(config.RouteTarget{Upstream: config.Upstream{}.WithDefaults()})
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var dials int64
+			legacy := newBenchServer(time.Millisecond, &dials)
+			defer legacy.Close()
+			modern := newBenchServer(time.Millisecond, &dials)
+			defer modern.Close()
+
+			var mu sync.Mutex
+			var latencies []time.Duration
+			b.ReportAllocs()
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var local []time.Duration
+				for pb.Next() {
+					start := time.Now()
+					if err := shadowed(bc.client(), legacy.URL, modern.URL); err != nil {
+						b.Error(err)
+						return
+					}
+					local = append(local, time.Since(start))
+				}
+				mu.Lock()
+				latencies = append(latencies, local...)
+				mu.Unlock()
+			})
+			b.StopTimer()
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			if len(latencies) > 0 {
+				p99 := latencies[int(float64(len(latencies)-1)*0.99)]
+				b.ReportMetric(float64(p99.Microseconds()), "p99-µs")
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&dials)), "dials")
+		})
+	}
+}
+
+// shadowed calls both backends at once and reads both bodies.
+func shadowed(client *http.Client, legacyURL, modernURL string) error {
+	errs := make(chan error, 2)
+	for _, url := range []string{legacyURL, modernURL} {
+		go func(url string) {
+			resp, err := client.Post(url+"/api/transfer-funds", "application/json", bytes.NewReader(benchBody))
+			if err != nil {
+				errs <- err
+				return
+			}
+			_, err = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			errs <- err
+		}(url)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newBenchServer(latency time.Duration, dials *int64) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		time.Sleep(latency)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success","balance":1000.25}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(dials, 1)
+		}
+	}
+	server.Start()
+	return server
+}